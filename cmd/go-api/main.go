@@ -8,29 +8,65 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/sonarping/go-nodeapi/pkg/config"
+	"github.com/sonarping/go-nodeapi/pkg/podmanapi"
 	"github.com/sonarping/go-nodeapi/pkg/routes"
 )
 
+// bodies larger than this are truncated in the request log
+const maxLoggedBody = 64 << 10
+
 type bodyLogWriter struct {
 	gin.ResponseWriter
 	body *bytes.Buffer
 }
 
 func (w *bodyLogWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)                  // capture for logging
+	if room := maxLoggedBody - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(len(b), room)]) // capture for logging
+	}
 	return w.ResponseWriter.Write(b) // write out as normal
 }
 
+// Unwrap lets http.ResponseController reach the underlying connection
+func (w *bodyLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// uploadPaths take archives whatever content type the client sends
+var uploadPaths = map[string]bool{
+	"/images/load":  true,
+	"/images/build": true,
+}
+
+// isBinaryBody reports whether the request carries an upload that must not be
+// buffered for logging (build contexts, image archives, ...)
+func isBinaryBody(r *http.Request) bool {
+	if r.Method == http.MethodPost && uploadPaths[r.URL.Path] {
+		return true
+	}
+	contentType := r.Header.Get("Content-Type")
+	return strings.HasPrefix(contentType, "multipart/") ||
+		strings.HasPrefix(contentType, "application/octet-stream") ||
+		strings.HasPrefix(contentType, "application/x-tar") ||
+		strings.HasPrefix(contentType, "application/gzip") ||
+		strings.HasPrefix(contentType, "application/x-gzip")
+}
+
 func LoggingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 
 		var reqBody []byte
-		if c.Request.Body != nil {
+		if c.Request.Body != nil && isBinaryBody(c.Request) {
+			reqBody = []byte("<binary upload>")
+		} else if c.Request.Body != nil {
 			reqBody, _ = io.ReadAll(c.Request.Body)
 			c.Request.Body = io.NopCloser(bytes.NewBuffer(reqBody))
 		}
@@ -63,13 +99,49 @@ func LoggingMiddleware() gin.HandlerFunc {
 	}
 }
 
+// matches credentials in JSON request bodies so they never reach the log
+var secretPattern = regexp.MustCompile(`"(password|token)"\s*:\s*"[^"]*"`)
+
 func sanitize(b []byte) string {
-	s := string(b)
+	s := secretPattern.ReplaceAllString(string(b), `"$1":"***"`)
 	s = string(bytes.ReplaceAll([]byte(s), []byte{'\n'}, []byte{' '}))
 	s = string(bytes.ReplaceAll([]byte(s), []byte{'"'}, []byte{'`'}))
 	return s
 }
 
+// startScheduledPrune starts the periodic prune if an interval is configured
+func startScheduledPrune(cfg config.PruneConfig) {
+	interval, _ := cfg.IntervalDuration()
+	if interval == 0 {
+		return
+	}
+	podmanContext, err := podmanapi.InitPodmanConnection()
+	if err != nil {
+		log.Printf("Scheduled prune disabled, error connecting to Podman Socket: %s", err)
+		return
+	}
+	podmanapi.StartPruneScheduler(podmanContext, interval, podmanapi.PruneOptions{
+		Images:     true,
+		AllImages:  cfg.AllImages,
+		BuildCache: cfg.BuildCache,
+		Containers: cfg.Containers,
+		Volumes:    cfg.Volumes,
+		Until:      cfg.Until,
+		Labels:     cfg.Labels,
+	})
+	log.Printf("Scheduled prune every %s", interval)
+}
+
+// startNetworkWatcher keeps isolation rules, bandwidth limits and output collectors in sync with the running containers
+func startNetworkWatcher() {
+	podmanContext, err := podmanapi.InitPodmanConnection()
+	if err != nil {
+		log.Printf("Network policies disabled, error connecting to Podman Socket: %s", err)
+		return
+	}
+	podmanapi.StartNetworkWatcher(podmanContext)
+}
+
 func main() {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
@@ -99,6 +171,16 @@ func main() {
 	// for listing, starting, stopping, removing ebpf services
 	routes.RegisterEBPFRoutes(router)
 
+	// for node wide disk usage and pruning
+	routes.RegisterSystemRoutes(router)
+
+	cfg, err := config.Get()
+	if err != nil {
+		log.Fatalf("Failed to load config: %s", err)
+	}
+	startScheduledPrune(cfg.Prune)
+	startNetworkWatcher()
+
 	server := &http.Server{
 		Addr:         ":8888",
 		Handler:      router,
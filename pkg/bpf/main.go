@@ -0,0 +1,204 @@
+package bpf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Dependency injection variables for testing:
+var runBPFToolFunc = runBPFTool
+
+// Process is a process holding a file descriptor of a BPF object.
+type Process struct {
+	PID  int    `json:"pid"`
+	Comm string `json:"comm"`
+}
+
+// Program is a BPF program loaded in the kernel.
+type Program struct {
+	ID       uint32 `json:"id"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Tag      string `json:"tag"`
+	LoadedAt int64  `json:"loaded_at"`
+	// locked memory in bytes
+	Memory uint64    `json:"bytes_memlock"`
+	MapIDs []uint32  `json:"map_ids"`
+	PIDs   []Process `json:"pids"`
+}
+
+// Map is a BPF map.
+type Map struct {
+	ID         uint32    `json:"id"`
+	Type       string    `json:"type"`
+	Name       string    `json:"name"`
+	KeySize    uint32    `json:"bytes_key"`
+	ValueSize  uint32    `json:"bytes_value"`
+	MaxEntries uint32    `json:"max_entries"`
+	Memory     uint64    `json:"bytes_memlock"`
+	PIDs       []Process `json:"pids"`
+}
+
+// Link attaches a program to a hook.
+type Link struct {
+	ID         uint32    `json:"id"`
+	Type       string    `json:"type"`
+	ProgID     uint32    `json:"prog_id"`
+	AttachType string    `json:"attach_type"`
+	PIDs       []Process `json:"pids"`
+
+	// hook details, which of them are set depends on the link type
+	FuncName string `json:"func_name"`
+	TPName   string `json:"tp_name"`
+	DevName  string `json:"devname"`
+	IfIndex  int    `json:"ifindex"`
+	CgroupID uint64 `json:"cgroup_id"`
+}
+
+// AttachPoint describes where the link is attached in one string, e.g.
+// "kprobe do_sys_open" or "xdp eth0".
+func (l Link) AttachPoint() string {
+	parts := []string{}
+	if l.AttachType != "" {
+		parts = append(parts, l.AttachType)
+	} else if l.Type != "" {
+		parts = append(parts, l.Type)
+	}
+	switch {
+	case l.FuncName != "":
+		parts = append(parts, l.FuncName)
+	case l.TPName != "":
+		parts = append(parts, l.TPName)
+	case l.DevName != "":
+		parts = append(parts, l.DevName)
+	case l.IfIndex != 0:
+		parts = append(parts, fmt.Sprintf("ifindex %d", l.IfIndex))
+	case l.CgroupID != 0:
+		parts = append(parts, fmt.Sprintf("cgroup %d", l.CgroupID))
+	}
+	return strings.Join(parts, " ")
+}
+
+func ListPrograms() ([]Program, error) {
+	programs := []Program{}
+	return programs, list("prog", &programs)
+}
+
+func ListMaps() ([]Map, error) {
+	maps := []Map{}
+	return maps, list("map", &maps)
+}
+
+func ListLinks() ([]Link, error) {
+	links := []Link{}
+	return links, list("link", &links)
+}
+
+// MapEntry is one key of a map dump, key and values are hex encoded.
+type MapEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// per-CPU maps have a value per CPU instead of Value
+	Values []CPUValue `json:"values,omitempty"`
+	// key and value decoded with the map's BTF, when it has any
+	Decoded json.RawMessage `json:"decoded,omitempty"`
+}
+
+type CPUValue struct {
+	CPU   int    `json:"cpu"`
+	Value string `json:"value"`
+}
+
+// bpftool prints bytes as arrays of "0x.." strings
+type rawMapEntry struct {
+	Key    []string `json:"key"`
+	Value  []string `json:"value"`
+	Values []struct {
+		CPU   int      `json:"cpu"`
+		Value []string `json:"value"`
+	} `json:"values"`
+	Formatted json.RawMessage `json:"formatted"`
+}
+
+// MapInfo returns the map with the given ID.
+func MapInfo(id uint32) (Map, error) {
+	return show("id", fmt.Sprint(id))
+}
+
+// PinnedMapInfo returns the map pinned at path on a bpf filesystem.
+func PinnedMapInfo(path string) (Map, error) {
+	return show("pinned", path)
+}
+
+func show(args ...string) (Map, error) {
+	var m Map
+	out, err := runBPFToolFunc(append([]string{"map", "show"}, args...)...)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(out, &m); err != nil {
+		return m, fmt.Errorf("error parsing bpftool map output: %v", err)
+	}
+	return m, nil
+}
+
+// DumpMap returns all entries of the map with the given ID.
+func DumpMap(id uint32) ([]MapEntry, error) {
+	out, err := runBPFToolFunc("map", "dump", "id", fmt.Sprint(id))
+	if err != nil {
+		return nil, err
+	}
+	raw := []rawMapEntry{}
+	if len(bytes.TrimSpace(out)) > 0 {
+		if err := json.Unmarshal(out, &raw); err != nil {
+			return nil, fmt.Errorf("error parsing bpftool map dump: %v", err)
+		}
+	}
+	entries := make([]MapEntry, 0, len(raw))
+	for _, r := range raw {
+		entry := MapEntry{Key: hexBytes(r.Key), Value: hexBytes(r.Value), Decoded: r.Formatted}
+		for _, v := range r.Values {
+			entry.Values = append(entry.Values, CPUValue{CPU: v.CPU, Value: hexBytes(v.Value)})
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// hexBytes joins ["0x0a", "0x00"] into "0a00".
+func hexBytes(b []string) string {
+	var sb strings.Builder
+	for _, s := range b {
+		sb.WriteString(strings.TrimPrefix(s, "0x"))
+	}
+	return sb.String()
+}
+
+func list(object string, v interface{}) error {
+	out, err := runBPFToolFunc(object, "show")
+	if err != nil {
+		return err
+	}
+	// bpftool prints nothing at all instead of [] on some versions
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("error parsing bpftool %s output: %v", object, err)
+	}
+	return nil
+}
+
+func runBPFTool(args ...string) ([]byte, error) {
+	cmd := exec.Command("bpftool", append([]string{"--json"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("bpftool %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/sonarping/go-nodeapi/pkg/trust"
+)
+
+const defaultConfigPath = "/etc/abra/nodeapi.json"
+
+// Config holds the daemon configuration read from the JSON config file.
+// Every section is optional; a missing file yields the defaults.
+type Config struct {
+	Prune PruneConfig  `json:"prune"`
+	Trust trust.Policy `json:"trust"`
+	EBPF  EBPFConfig   `json:"ebpf"`
+}
+
+// PruneConfig controls the scheduled cleanup of unused podman resources.
+type PruneConfig struct {
+	// Interval between scheduled prunes as a Go duration, empty disables the schedule
+	Interval   string   `json:"interval"`
+	AllImages  bool     `json:"all_images"`
+	BuildCache bool     `json:"build_cache"`
+	Containers bool     `json:"containers"`
+	Volumes    bool     `json:"volumes"`
+	Until      string   `json:"until"`
+	Labels     []string `json:"labels"`
+}
+
+// EBPFConfig configures the eBPF environments.
+type EBPFConfig struct {
+	// named mount sets selectable on create-ebpf, replacing or adding to the
+	// built-in tracing, networking and minimal profiles
+	MountProfiles map[string][]Mount `json:"mount_profiles"`
+	// profile used when a request names none, defaults to networking
+	DefaultMountProfile string `json:"default_mount_profile"`
+}
+
+// Mount is a host directory bind mounted, or a tmpfs or a bpf filesystem of
+// its own created in a container. "{kernel}" in Source and Destination is
+// replaced by the running kernel's release.
+type Mount struct {
+	// bind, tmpfs or bpf
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	ReadOnly    bool     `json:"read_only"`
+	Options     []string `json:"options"`
+}
+
+var profileNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+func (e EBPFConfig) validate() error {
+	for name, mounts := range e.MountProfiles {
+		if !profileNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid mount profile name %q", name)
+		}
+		for _, m := range mounts {
+			if err := m.validate(); err != nil {
+				return fmt.Errorf("mount profile %s: %w", name, err)
+			}
+		}
+	}
+	if e.DefaultMountProfile != "" && !profileNameRegexp.MatchString(e.DefaultMountProfile) {
+		return fmt.Errorf("invalid default mount profile %q", e.DefaultMountProfile)
+	}
+	return nil
+}
+
+func (m Mount) validate() error {
+	if !filepath.IsAbs(m.Destination) {
+		return fmt.Errorf("mount destination %q must be absolute", m.Destination)
+	}
+	switch m.Type {
+	case "bind":
+		if !filepath.IsAbs(m.Source) {
+			return fmt.Errorf("bind mount source %q must be absolute", m.Source)
+		}
+	case "tmpfs", "bpf":
+	default:
+		return fmt.Errorf("invalid mount type %q for %s, expected bind, tmpfs or bpf", m.Type, m.Destination)
+	}
+	return nil
+}
+
+// Dependency injection variables for easier testing.
+var (
+	readFileFunc = os.ReadFile
+	getenvFunc   = os.Getenv
+)
+
+var (
+	loadOnce sync.Once
+	current  *Config
+	loadErr  error
+)
+
+// Path returns the config file location, overridable with ABRA_NODEAPI_CONFIG.
+func Path() string {
+	if p := getenvFunc("ABRA_NODEAPI_CONFIG"); p != "" {
+		return p
+	}
+	return defaultConfigPath
+}
+
+// Load reads and validates the config file.
+func Load() (*Config, error) {
+	cfg := new(Config)
+	path := Path()
+	data, err := readFileFunc(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Get returns the config loaded on first use.
+func Get() (*Config, error) {
+	loadOnce.Do(func() {
+		current, loadErr = Load()
+	})
+	return current, loadErr
+}
+
+func (c *Config) validate() error {
+	if _, err := c.Prune.IntervalDuration(); err != nil {
+		return err
+	}
+	if err := c.EBPF.validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IntervalDuration parses Interval, returning 0 when scheduling is disabled.
+func (p PruneConfig) IntervalDuration() (time.Duration, error) {
+	if p.Interval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(p.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("prune interval: %w", err)
+	}
+	if d < time.Minute {
+		return 0, fmt.Errorf("prune interval must be at least 1m, got %s", p.Interval)
+	}
+	return d, nil
+}
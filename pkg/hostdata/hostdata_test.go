@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/mem"
 )
 
@@ -15,6 +16,7 @@ func saveOriginals() (func(), error) {
 	origReadFile := readFileFunc
 	origCpuPercent := cpuPercentFunc
 	origVirtualMemory := virtualMemoryFunc
+	origDiskUsage := diskUsageFunc
 
 	// Return a function to restore originals.
 	restore := func() {
@@ -22,6 +24,7 @@ func saveOriginals() (func(), error) {
 		readFileFunc = origReadFile
 		cpuPercentFunc = origCpuPercent
 		virtualMemoryFunc = origVirtualMemory
+		diskUsageFunc = origDiskUsage
 	}
 	return restore, nil
 }
@@ -188,3 +191,42 @@ OTHER="ignored"`
 		t.Errorf("expected OSVersion '2.0', got: %s", info.OSVersion)
 	}
 }
+
+func TestGetHostInfo_Partitions(t *testing.T) {
+	restore, _ := saveOriginals()
+	defer restore()
+
+	hostnameFunc = func() (string, error) {
+		return "testhost", nil
+	}
+	readFileFunc = func(filename string) ([]byte, error) {
+		return []byte(`NAME="TestOS"`), nil
+	}
+	cpuPercentFunc = func(interval time.Duration, percpu bool) ([]float64, error) {
+		return []float64{10.0}, nil
+	}
+	virtualMemoryFunc = func() (*mem.VirtualMemoryStat, error) {
+		return &mem.VirtualMemoryStat{Total: 2048}, nil
+	}
+	// container storage is missing and must be skipped rather than failing
+	diskUsageFunc = func(path string) (*disk.UsageStat, error) {
+		if path == "/var/lib/containers/storage" {
+			return nil, errors.New("no such file or directory")
+		}
+		return &disk.UsageStat{Path: path, Total: 100, Used: 40, Free: 60, UsedPercent: 40.0}, nil
+	}
+
+	info, err := GetHostInfo()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(info.Partitions) != 2 {
+		t.Fatalf("expected 2 partitions, got: %#v", info.Partitions)
+	}
+	if info.Partitions[0].Name != "root" || info.Partitions[1].Path != "/var/log" {
+		t.Errorf("unexpected partitions: %#v", info.Partitions)
+	}
+	if info.Partitions[1].Free != 60 || info.Partitions[1].UsedPercent != 40.0 {
+		t.Errorf("unexpected usage: %#v", info.Partitions[1])
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/mem"
 )
 
@@ -24,6 +25,28 @@ type HostInfo struct {
 	TotalMemory   uint64  `json:"total_memory"`
 	NumContainers int     `json:"num_containers"`
 	IPAddress     string  `json:"ip_address"`
+
+	Partitions []PartitionUsage `json:"partitions"`
+}
+
+// PartitionUsage holds usage of the filesystem backing a path of interest.
+type PartitionUsage struct {
+	Name        string  `json:"name"`
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// paths whose filesystems are reported in HostInfo.Partitions
+var monitoredPaths = []struct {
+	name string
+	path string
+}{
+	{"root", "/"},
+	{"logs", "/var/log"},
+	{"container_storage", "/var/lib/containers/storage"},
 }
 
 // Dependency injection variables for easier testing.
@@ -32,6 +55,7 @@ var (
 	readFileFunc      = os.ReadFile
 	cpuPercentFunc    = cpu.Percent
 	virtualMemoryFunc = mem.VirtualMemory
+	diskUsageFunc     = disk.Usage
 )
 
 // GetHostInfo returns system information using injected functions.
@@ -74,9 +98,32 @@ func GetHostInfo() (*HostInfo, error) {
 
 	info.IPAddress = GetOutboundIP().String()
 
+	info.Partitions = getPartitionUsage()
+
 	return info, nil
 }
 
+// getPartitionUsage reports the monitored paths, skipping any that cannot be read.
+func getPartitionUsage() []PartitionUsage {
+	partitions := []PartitionUsage{}
+	for _, p := range monitoredPaths {
+		usage, err := diskUsageFunc(p.path)
+		if err != nil {
+			log.Printf("failed to get disk usage for %s: %v", p.path, err)
+			continue
+		}
+		partitions = append(partitions, PartitionUsage{
+			Name:        p.name,
+			Path:        p.path,
+			Total:       usage.Total,
+			Used:        usage.Used,
+			Free:        usage.Free,
+			UsedPercent: usage.UsedPercent,
+		})
+	}
+	return partitions
+}
+
 // GetOutboundIP returns the preferred outbound IP of this machine.
 func GetOutboundIP() net.IP {
 	// Connect to an external address. It doesn't have to be reachable,
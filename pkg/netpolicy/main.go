@@ -0,0 +1,280 @@
+package netpolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Ingress selects who may open connections to an environment.
+type Ingress string
+
+const (
+	// anyone may connect (the podman default)
+	IngressAll Ingress = "all"
+	// only the nginx proxy on this node may connect
+	IngressProxy Ingress = "proxy"
+	// the proxy and members of the same group may connect
+	IngressGroup Ingress = "group"
+)
+
+// all rules live in one table so a reconcile can replace them atomically;
+// the bridge family sees traffic between containers on the same bridge
+const tableName = "abra_isolation"
+
+var groupRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Policy restricts the traffic of one environment. The zero value is open.
+type Policy struct {
+	// drop new connections from the environment, except DNS to its gateway
+	// and connections to members of its group
+	DenyEgress bool    `json:"deny_egress"`
+	Ingress    Ingress `json:"ingress"`
+	// group the environment belongs to, required for IngressGroup
+	Group string `json:"group,omitempty"`
+}
+
+// Endpoint is a running environment the rules are generated for.
+type Endpoint struct {
+	Name string
+	IPs  []net.IP
+	// gateways of the environment's networks, which is where traffic from
+	// the proxy on this node originates
+	Gateways []net.IP
+	Policy   Policy
+}
+
+// Dependency injection variables for testing:
+var (
+	runNFTFunc = runNFT
+	statePath  = "/var/lib/abra/netpolicy.json"
+	storeMu    sync.Mutex
+)
+
+// SetStatePath points the policy store at path and returns a func restoring
+// the previous one, for tests of the packages reconciling policies.
+func SetStatePath(path string) (restore func()) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	orig := statePath
+	statePath = path
+	return func() {
+		storeMu.Lock()
+		defer storeMu.Unlock()
+		statePath = orig
+	}
+}
+
+func (p Policy) Validate() error {
+	switch p.Ingress {
+	case "", IngressAll, IngressProxy:
+	case IngressGroup:
+		if p.Group == "" {
+			return fmt.Errorf("group ingress requires a group")
+		}
+	default:
+		return fmt.Errorf("unsupported ingress %q, expected all, proxy or group", p.Ingress)
+	}
+	if p.Group != "" && !groupRegexp.MatchString(p.Group) {
+		return fmt.Errorf("invalid group name %q", p.Group)
+	}
+	return nil
+}
+
+// restrictsIngress reports whether new connections to the endpoint are filtered.
+func (p Policy) restrictsIngress() bool {
+	return p.Ingress == IngressProxy || p.Ingress == IngressGroup
+}
+
+// List returns the stored policies keyed by container name.
+func List() (map[string]Policy, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	return load()
+}
+
+// Get returns the policy of a container, ok is false if it has none.
+func Get(name string) (Policy, bool, error) {
+	policies, err := List()
+	if err != nil {
+		return Policy{}, false, err
+	}
+	policy, ok := policies[name]
+	return policy, ok, nil
+}
+
+// Set stores the policy of a container.
+func Set(name string, policy Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	policies, err := load()
+	if err != nil {
+		return err
+	}
+	policies[name] = policy
+	return save(policies)
+}
+
+// Delete removes the policy of a container.
+func Delete(name string) error {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	policies, err := load()
+	if err != nil {
+		return err
+	}
+	if _, ok := policies[name]; !ok {
+		return nil
+	}
+	delete(policies, name)
+	return save(policies)
+}
+
+func load() (map[string]Policy, error) {
+	policies := map[string]Policy{}
+	data, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return policies, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read network policies: %w", err)
+	}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("failed to parse network policies: %w", err)
+	}
+	return policies, nil
+}
+
+func save(policies map[string]Policy) error {
+	data, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+	if err := os.WriteFile(statePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write network policies: %w", err)
+	}
+	return nil
+}
+
+// Render generates an nft script that replaces the isolation table with
+// rules for the given endpoints.
+func Render(endpoints []Endpoint) string {
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Name < endpoints[j].Name })
+	groups := map[string][]net.IP{}
+	for _, ep := range endpoints {
+		if ep.Policy.Group != "" {
+			groups[ep.Policy.Group] = append(groups[ep.Policy.Group], ep.IPs...)
+		}
+	}
+
+	// ingress rules go first so an egress exception of one endpoint cannot
+	// open up another endpoint that restricts ingress
+	var forward, egress, input, output []string
+	for _, ep := range endpoints {
+		for _, ip := range ep.IPs {
+			family := "ip"
+			if ip.To4() == nil {
+				family = "ip6"
+			}
+			members := addrSet(family, groups[ep.Policy.Group])
+			gateways := addrSet(family, ep.Gateways)
+			comment := fmt.Sprintf(" comment %q", ep.Name)
+
+			if ep.Policy.restrictsIngress() {
+				// container to container on the bridge
+				if ep.Policy.Ingress == IngressGroup && members != "" {
+					forward = append(forward, fmt.Sprintf("%s daddr %s %s saddr %s accept%s", family, ip, family, members, comment))
+				}
+				forward = append(forward, fmt.Sprintf("%s daddr %s drop%s", family, ip, comment))
+				// the host itself and routed traffic, e.g. published ports
+				if gateways != "" {
+					output = append(output, fmt.Sprintf("%s daddr %s %s saddr != %s drop%s", family, ip, family, gateways, comment))
+				} else {
+					output = append(output, fmt.Sprintf("%s daddr %s drop%s", family, ip, comment))
+				}
+			}
+			if ep.Policy.DenyEgress {
+				if members != "" {
+					egress = append(egress, fmt.Sprintf("%s saddr %s %s daddr %s accept%s", family, ip, family, members, comment))
+				}
+				egress = append(egress, fmt.Sprintf("%s saddr %s drop%s", family, ip, comment))
+				if gateways != "" {
+					input = append(input, fmt.Sprintf("%s saddr %s %s daddr %s meta l4proto { tcp, udp } th dport 53 accept%s", family, ip, family, gateways, comment))
+				}
+				input = append(input, fmt.Sprintf("%s saddr %s drop%s", family, ip, comment))
+			}
+		}
+	}
+
+	var b strings.Builder
+	// declaring the table first makes the delete succeed when it does not exist yet
+	fmt.Fprintf(&b, "table bridge %s\ndelete table bridge %s\n", tableName, tableName)
+	fmt.Fprintf(&b, "table bridge %s {\n", tableName)
+	writeChain(&b, "forward", append(forward, egress...))
+	writeChain(&b, "input", input)
+	writeChain(&b, "output", output)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func writeChain(b *strings.Builder, hook string, rules []string) {
+	fmt.Fprintf(b, "\tchain %s {\n", hook)
+	fmt.Fprintf(b, "\t\ttype filter hook %s priority 0; policy accept;\n", hook)
+	// replies to connections that were allowed are never filtered
+	b.WriteString("\t\tct state established,related accept\n")
+	for _, rule := range rules {
+		fmt.Fprintf(b, "\t\t%s\n", rule)
+	}
+	b.WriteString("\t}\n")
+}
+
+// addrSet formats the addresses of family as an anonymous nft set.
+func addrSet(family string, ips []net.IP) string {
+	var addrs []string
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (family == "ip") {
+			addrs = append(addrs, ip.String())
+		}
+	}
+	if len(addrs) == 0 {
+		return ""
+	}
+	return "{ " + strings.Join(addrs, ", ") + " }"
+}
+
+// Apply replaces the isolation rules with rules for the given endpoints.
+// Without endpoints it only removes rules of a previous run and does not
+// require nft to be installed.
+func Apply(endpoints []Endpoint) error {
+	err := runNFTFunc(Render(endpoints))
+	if err != nil && len(endpoints) == 0 && errors.Is(err, exec.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func runNFT(script string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("applying nftables rules: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
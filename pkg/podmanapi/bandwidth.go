@@ -0,0 +1,329 @@
+package podmanapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	nettypes "github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/libpod/define"
+)
+
+// tc state is lost whenever podman recreates the veth, so limits are kept
+// per container name and reapplied on every start.
+var (
+	bandwidthMu        sync.Mutex
+	bandwidthStatePath = "/var/lib/abra/bandwidth.json"
+	// container starts and network events reshape the same veth concurrently
+	vethShaping keyedMutex
+)
+
+// Dependency injection variables for testing:
+var (
+	runTCFunc        = runTC
+	interfaceByIndex = net.InterfaceByIndex
+	procRoot         = "/proc"
+	sysClassNet      = "/sys/class/net"
+)
+
+// ErrNotShapeable is returned for limits on a container without a bridge
+// network, only the veth of a bridge can be shaped from the host.
+var ErrNotShapeable = errors.New("no bridge network to shape")
+
+// BandwidthLimits are rates in kbit/s as seen from the container, 0 is unlimited.
+type BandwidthLimits struct {
+	// download rate, shaped on the host side veth
+	IngressKbit uint64 `json:"ingress_kbit"`
+	// upload rate, policed on the host side veth's ingress
+	EgressKbit uint64 `json:"egress_kbit"`
+}
+
+func (l BandwidthLimits) IsZero() bool {
+	return l.IngressKbit == 0 && l.EgressKbit == 0
+}
+
+// InterfaceCounters are the traffic counters of one container interface,
+// seen from the container.
+type InterfaceCounters struct {
+	// host side veth
+	Interface      string `json:"interface"`
+	RxBytes        uint64 `json:"rx_bytes"`
+	RxPackets      uint64 `json:"rx_packets"`
+	TxBytes        uint64 `json:"tx_bytes"`
+	TxPackets      uint64 `json:"tx_packets"`
+	IngressDropped uint64 `json:"ingress_dropped"`
+	EgressDropped  uint64 `json:"egress_dropped"`
+}
+
+type BandwidthStatus struct {
+	Limits     BandwidthLimits     `json:"limits"`
+	Interfaces []InterfaceCounters `json:"interfaces"`
+}
+
+func loadBandwidthLimits() (map[string]BandwidthLimits, error) {
+	limits := map[string]BandwidthLimits{}
+	if err := readState(bandwidthStatePath, &limits); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// storeBandwidthLimits remembers the limits of a container, zero limits forget it.
+func storeBandwidthLimits(name string, limits BandwidthLimits) error {
+	bandwidthMu.Lock()
+	defer bandwidthMu.Unlock()
+	stored, err := loadBandwidthLimits()
+	if err != nil {
+		return err
+	}
+	if _, ok := stored[name]; !ok && limits.IsZero() {
+		return nil
+	}
+	if limits.IsZero() {
+		delete(stored, name)
+	} else {
+		stored[name] = limits
+	}
+	return writeState(bandwidthStatePath, stored)
+}
+
+func storedBandwidthLimits(name string) (BandwidthLimits, bool, error) {
+	bandwidthMu.Lock()
+	defer bandwidthMu.Unlock()
+	stored, err := loadBandwidthLimits()
+	if err != nil {
+		return BandwidthLimits{}, false, err
+	}
+	limits, ok := stored[name]
+	return limits, ok, nil
+}
+
+// checkShapeable fails for limits on networks none of which is a bridge,
+// macvlan and ipvlan interfaces have no host side veth.
+func checkShapeable(ctx context.Context, networks []string, limits BandwidthLimits) error {
+	if limits.IsZero() {
+		return nil
+	}
+	for _, networkName := range networks {
+		report, err := networkInspect(ctx, networkName, nil)
+		if err != nil {
+			return fmt.Errorf("error inspecting network %s: %v", networkName, err)
+		}
+		if report.Driver == nettypes.BridgeNetworkDriver {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: bandwidth limits need a bridge network, got %s", ErrNotShapeable, strings.Join(networks, ", "))
+}
+
+// SetBandwidthLimits stores new limits for a container and applies them
+// right away if it is running.
+func SetBandwidthLimits(ctx context.Context, containerID string, limits BandwidthLimits) error {
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return err
+	}
+	networks := []string{}
+	if inspectData.NetworkSettings != nil {
+		for networkName := range inspectData.NetworkSettings.Networks {
+			networks = append(networks, networkName)
+		}
+	}
+	sort.Strings(networks)
+	if err := checkShapeable(ctx, networks, limits); err != nil {
+		return err
+	}
+	if err := storeBandwidthLimits(inspectData.Name, limits); err != nil {
+		return err
+	}
+	if inspectData.State.Status != define.ContainerStateRunning.String() {
+		return nil
+	}
+	return shapeContainer(inspectData.State.Pid, limits)
+}
+
+// ApplyStoredBandwidth reapplies the stored limits of a running container.
+func ApplyStoredBandwidth(ctx context.Context, containerID string) error {
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return err
+	}
+	limits, ok, err := storedBandwidthLimits(inspectData.Name)
+	if err != nil || !ok {
+		return err
+	}
+	if inspectData.State.Status != define.ContainerStateRunning.String() {
+		return nil
+	}
+	return shapeContainer(inspectData.State.Pid, limits)
+}
+
+// GetBandwidthStatus returns the limits of a container and, while it runs,
+// the counters of its interfaces.
+func GetBandwidthStatus(ctx context.Context, containerID string) (BandwidthStatus, error) {
+	status := BandwidthStatus{Interfaces: []InterfaceCounters{}}
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return status, err
+	}
+	status.Limits, _, err = storedBandwidthLimits(inspectData.Name)
+	if err != nil {
+		return status, err
+	}
+	if inspectData.State.Status != define.ContainerStateRunning.String() {
+		return status, nil
+	}
+	veths, err := hostVeths(inspectData.State.Pid)
+	if err != nil {
+		return status, err
+	}
+	for _, veth := range veths {
+		status.Interfaces = append(status.Interfaces, interfaceCounters(veth))
+	}
+	return status, nil
+}
+
+func shapeContainer(pid int, limits BandwidthLimits) error {
+	veths, err := hostVeths(pid)
+	if err != nil {
+		return err
+	}
+	if len(veths) == 0 && !limits.IsZero() {
+		return fmt.Errorf("container has no veth interface to shape")
+	}
+	for _, veth := range veths {
+		if err := shapeVeth(veth, limits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostVeths finds the host side peers of the container's veth interfaces.
+// Interfaces such as macvlan also point at a host interface, which must not
+// be shaped, so only peers named veth* are returned.
+func hostVeths(pid int) ([]string, error) {
+	ctrNet := filepath.Join(procRoot, strconv.Itoa(pid), "root", "sys", "class", "net")
+	entries, err := os.ReadDir(ctrNet)
+	if err != nil {
+		return nil, fmt.Errorf("error reading container interfaces: %v", err)
+	}
+	var veths []string
+	for _, entry := range entries {
+		if entry.Name() == "lo" {
+			continue
+		}
+		ifindex, err1 := readUint(filepath.Join(ctrNet, entry.Name(), "ifindex"))
+		iflink, err2 := readUint(filepath.Join(ctrNet, entry.Name(), "iflink"))
+		if err1 != nil || err2 != nil || ifindex == iflink {
+			continue
+		}
+		peer, err := interfaceByIndex(int(iflink))
+		if err != nil || !strings.HasPrefix(peer.Name, "veth") {
+			continue
+		}
+		veths = append(veths, peer.Name)
+	}
+	return veths, nil
+}
+
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// shapeVeth replaces the qdiscs on dev. Traffic the host sends out of dev is
+// what the container downloads, traffic arriving on dev is its upload.
+func shapeVeth(dev string, limits BandwidthLimits) error {
+	defer vethShaping.lock(dev)()
+	// deleting fails when there is nothing to delete, which is fine
+	runTCFunc("qdisc", "del", "dev", dev, "root")
+	runTCFunc("qdisc", "del", "dev", dev, "ingress")
+
+	if limits.IngressKbit > 0 {
+		rate := fmt.Sprintf("%dkbit", limits.IngressKbit)
+		if _, err := runTCFunc("qdisc", "add", "dev", dev, "root", "tbf", "rate", rate, "burst", burstFor(limits.IngressKbit), "latency", "50ms"); err != nil {
+			return err
+		}
+	}
+	if limits.EgressKbit > 0 {
+		rate := fmt.Sprintf("%dkbit", limits.EgressKbit)
+		if _, err := runTCFunc("qdisc", "add", "dev", dev, "ingress"); err != nil {
+			return err
+		}
+		if _, err := runTCFunc("filter", "add", "dev", dev, "parent", "ffff:", "protocol", "all", "prio", "1",
+			"u32", "match", "u32", "0", "0", "police", "rate", rate, "burst", burstFor(limits.EgressKbit), "drop", "flowid", ":1"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// burstFor allows 100ms worth of traffic in a burst, at least 16KiB so
+// full sized packets always fit.
+func burstFor(kbit uint64) string {
+	burst := kbit * 1000 / 8 / 10
+	if burst < 16*1024 {
+		burst = 16 * 1024
+	}
+	return strconv.FormatUint(burst, 10)
+}
+
+func interfaceCounters(veth string) InterfaceCounters {
+	stat := func(name string) uint64 {
+		v, _ := readUint(filepath.Join(sysClassNet, veth, "statistics", name))
+		return v
+	}
+	counters := InterfaceCounters{
+		Interface: veth,
+		// the host's transmit side is the container's receive side
+		RxBytes:   stat("tx_bytes"),
+		RxPackets: stat("tx_packets"),
+		TxBytes:   stat("rx_bytes"),
+		TxPackets: stat("rx_packets"),
+	}
+	out, err := runTCFunc("-s", "-j", "qdisc", "show", "dev", veth)
+	if err != nil {
+		return counters
+	}
+	var qdiscs []struct {
+		Kind  string `json:"kind"`
+		Root  bool   `json:"root"`
+		Drops uint64 `json:"drops"`
+	}
+	if err := json.Unmarshal(out, &qdiscs); err != nil {
+		return counters
+	}
+	for _, q := range qdiscs {
+		switch {
+		case q.Kind == "ingress":
+			counters.EgressDropped = q.Drops
+		case q.Root:
+			counters.IngressDropped = q.Drops
+		}
+	}
+	return counters
+}
+
+func runTC(args ...string) ([]byte, error) {
+	out, err := exec.Command("tc", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("tc %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("tc %s: %v", strings.Join(args, " "), err)
+	}
+	return out, nil
+}
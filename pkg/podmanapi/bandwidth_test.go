@@ -0,0 +1,168 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	nettypes "github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/bindings/network"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+)
+
+// fakeContainerNet lays out /proc/<pid>/root/sys/class/net for a container
+// whose eth0 is paired with host ifindex 7 and whose macvlan0 sits on ifindex 2.
+func fakeContainerNet(t *testing.T, pid int) {
+	t.Helper()
+	ifaces := map[string][2]string{"lo": {"1", "1"}, "eth0": {"3", "7"}, "macvlan0": {"4", "2"}}
+	for name, idx := range ifaces {
+		dir := filepath.Join(procRoot, fmt.Sprint(pid), "root", "sys", "class", "net", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(dir, "ifindex"), []byte(idx[0]+"\n"), 0644)
+		os.WriteFile(filepath.Join(dir, "iflink"), []byte(idx[1]+"\n"), 0644)
+	}
+}
+
+func TestSetBandwidthLimits(t *testing.T) {
+	origInspect := containersInspect
+	origNetInspect := networkInspect
+	origTC := runTCFunc
+	origByIndex := interfaceByIndex
+	origProc := procRoot
+	origState := bandwidthStatePath
+	defer func() {
+		containersInspect = origInspect
+		networkInspect = origNetInspect
+		runTCFunc = origTC
+		interfaceByIndex = origByIndex
+		procRoot = origProc
+		bandwidthStatePath = origState
+	}()
+	procRoot = t.TempDir()
+	bandwidthStatePath = filepath.Join(t.TempDir(), "bandwidth.json")
+	fakeContainerNet(t, 4242)
+
+	containersInspect = func(ctx context.Context, nameOrID string, options *containers.InspectOptions) (*define.InspectContainerData, error) {
+		return &define.InspectContainerData{
+			Name:  "env1",
+			State: &define.InspectContainerState{Status: define.ContainerStateRunning.String(), Pid: 4242},
+			NetworkSettings: &define.InspectNetworkSettings{Networks: map[string]*define.InspectAdditionalNetwork{
+				"podman": {}, "lan": {},
+			}},
+		}, nil
+	}
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		drivers := map[string]string{"podman": "bridge", "lan": "macvlan"}
+		return entitiesTypes.NetworkInspectReport{Network: nettypes.Network{Name: nameOrID, Driver: drivers[nameOrID]}}, nil
+	}
+	interfaceByIndex = func(index int) (*net.Interface, error) {
+		names := map[int]string{7: "veth3", 2: "enp1s0"}
+		return &net.Interface{Index: index, Name: names[index]}, nil
+	}
+	var calls []string
+	runTCFunc = func(args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return nil, nil
+	}
+
+	err := SetBandwidthLimits(context.Background(), "env1", BandwidthLimits{IngressKbit: 10000, EgressKbit: 2000})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	expected := []string{
+		"qdisc del dev veth3 root",
+		"qdisc del dev veth3 ingress",
+		"qdisc add dev veth3 root tbf rate 10000kbit burst 125000 latency 50ms",
+		"qdisc add dev veth3 ingress",
+		"filter add dev veth3 parent ffff: protocol all prio 1 u32 match u32 0 0 police rate 2000kbit burst 25000 drop flowid :1",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected tc calls, the macvlan parent must not be shaped:\n%s", strings.Join(calls, "\n"))
+	}
+
+	limits, ok, err := storedBandwidthLimits("env1")
+	if err != nil || !ok || limits.EgressKbit != 2000 {
+		t.Errorf("expected limits to be stored, got: %#v %v %v", limits, ok, err)
+	}
+}
+
+func TestCheckShapeable(t *testing.T) {
+	origNetInspect := networkInspect
+	defer func() { networkInspect = origNetInspect }()
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		drivers := map[string]string{"podman": "bridge", "lan": "macvlan", "l3": "ipvlan"}
+		return entitiesTypes.NetworkInspectReport{Network: nettypes.Network{Name: nameOrID, Driver: drivers[nameOrID]}}, nil
+	}
+	limits := BandwidthLimits{IngressKbit: 1000}
+
+	if err := checkShapeable(context.Background(), []string{"lan", "podman"}, limits); err != nil {
+		t.Errorf("expected a bridge network to be shapeable, got: %v", err)
+	}
+	for _, networks := range [][]string{{"lan"}, {"l3"}, {"lan", "l3"}, {}} {
+		if err := checkShapeable(context.Background(), networks, limits); !errors.Is(err, ErrNotShapeable) {
+			t.Errorf("%v: expected ErrNotShapeable, got: %v", networks, err)
+		}
+	}
+	if err := checkShapeable(context.Background(), []string{"lan"}, BandwidthLimits{}); err != nil {
+		t.Errorf("expected clearing limits to always pass, got: %v", err)
+	}
+}
+
+func TestShapeVeth_Concurrent(t *testing.T) {
+	origTC := runTCFunc
+	defer func() { runTCFunc = origTC }()
+	// a fake tc keeping the qdiscs of one device
+	var mu sync.Mutex
+	qdiscs := map[string]bool{}
+	runTCFunc = func(args ...string) ([]byte, error) {
+		// tc takes a while, giving concurrent calls a chance to interleave
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		if args[0] != "qdisc" {
+			return nil, nil
+		}
+		kind := args[4]
+		switch args[1] {
+		case "del":
+			if !qdiscs[kind] {
+				return nil, fmt.Errorf("no qdisc to delete")
+			}
+			delete(qdiscs, kind)
+		case "add":
+			if qdiscs[kind] {
+				return nil, fmt.Errorf("Exclusivity flag on, cannot modify")
+			}
+			qdiscs[kind] = true
+		}
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- shapeVeth("veth3", BandwidthLimits{IngressKbit: 1000, EgressKbit: 1000})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("expected concurrent shaping to succeed, got: %v", err)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/sonarping/go-nodeapi/pkg/bpf"
+	"github.com/sonarping/go-nodeapi/pkg/utils"
+)
+
+const (
+	bpffsRoot          = "/sys/fs/bpf"
+	defaultMapDumpPage = 100
+	maxMapDumpPage     = 1000
+)
+
+// ErrMapNotOwned is returned when a map does not belong to the container it
+// is read through.
+var ErrMapNotOwned = errors.New("map is not owned by the container")
+
+// Dependency injection variables for testing:
+var (
+	bpfListPrograms  = bpf.ListPrograms
+	bpfListMaps      = bpf.ListMaps
+	bpfListLinks     = bpf.ListLinks
+	bpfMapInfo       = bpf.MapInfo
+	bpfPinnedMapInfo = bpf.PinnedMapInfo
+	bpfDumpMap       = bpf.DumpMap
+)
+
+// matches the scope podman puts a container in, with the systemd and the
+// cgroupfs cgroup manager
+var libpodCgroupRegexp = regexp.MustCompile(`/libpod-([0-9a-f]{64})(\.scope)?(/|$)`)
+
+// BPFOwner is a process holding a BPF object and the container and unit it
+// runs in, if any.
+type BPFOwner struct {
+	PID       int    `json:"pid"`
+	Comm      string `json:"comm"`
+	ID        string `json:"env_id,omitempty"`
+	Container string `json:"container,omitempty"`
+	Unit      string `json:"unit,omitempty"`
+}
+
+type BPFProgram struct {
+	ID           uint32     `json:"id"`
+	Type         string     `json:"type"`
+	Name         string     `json:"name"`
+	Tag          string     `json:"tag"`
+	AttachPoints []string   `json:"attach_points"`
+	Memory       uint64     `json:"memory"`
+	LoadedAt     int64      `json:"loaded_at"`
+	MapIDs       []uint32   `json:"map_ids"`
+	Owners       []BPFOwner `json:"owners"`
+}
+
+type BPFMap struct {
+	ID         uint32     `json:"id"`
+	Type       string     `json:"type"`
+	Name       string     `json:"name"`
+	KeySize    uint32     `json:"key_size"`
+	ValueSize  uint32     `json:"value_size"`
+	MaxEntries uint32     `json:"max_entries"`
+	Memory     uint64     `json:"memory"`
+	Owners     []BPFOwner `json:"owners"`
+}
+
+type BPFLink struct {
+	ID          uint32     `json:"id"`
+	Type        string     `json:"type"`
+	ProgramID   uint32     `json:"program_id"`
+	AttachPoint string     `json:"attach_point"`
+	Owners      []BPFOwner `json:"owners"`
+}
+
+// BPFObjects is what is loaded in the kernel of this node.
+type BPFObjects struct {
+	Programs []BPFProgram `json:"programs"`
+	Maps     []BPFMap     `json:"maps"`
+	Links    []BPFLink    `json:"links"`
+}
+
+// cgroupOwner finds the container and unit a host pid runs in from its
+// cgroup path. Processes outside containers return empty strings.
+func cgroupOwner(pid int) (containerID string, unit string) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// hierarchy-ID:controllers:path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		loc := libpodCgroupRegexp.FindStringSubmatchIndex(fields[2])
+		if loc == nil {
+			continue
+		}
+		containerID = fields[2][loc[2]:loc[3]]
+		for _, elem := range strings.Split(fields[2][loc[1]:], "/") {
+			if strings.HasSuffix(elem, ".service") {
+				unit = elem
+			}
+		}
+		return containerID, unit
+	}
+	return "", ""
+}
+
+// bpfOwners attributes the processes holding an object to containers.
+func bpfOwners(pids []bpf.Process, names map[string]string) []BPFOwner {
+	owners := make([]BPFOwner, 0, len(pids))
+	for _, p := range pids {
+		owner := BPFOwner{PID: p.PID, Comm: p.Comm}
+		owner.ID, owner.Unit = cgroupOwner(p.PID)
+		owner.Container = names[owner.ID]
+		owners = append(owners, owner)
+	}
+	return owners
+}
+
+func ownedBy(owners []BPFOwner, containerID string) bool {
+	for _, o := range owners {
+		if o.ID == containerID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBPFObjects lists the BPF programs, maps and links loaded on this node.
+// With a container ID only the objects held by processes of that container
+// are returned, along with the maps and links of its programs.
+func GetBPFObjects(ctx context.Context, containerID string) (BPFObjects, error) {
+	objects := BPFObjects{Programs: []BPFProgram{}, Maps: []BPFMap{}, Links: []BPFLink{}}
+
+	names := map[string]string{}
+	ctrList, err := containersList(ctx, &containers.ListOptions{All: utils.GetPtr(true)})
+	if err != nil {
+		return objects, fmt.Errorf("error listing containers: %v", err)
+	}
+	for _, ctr := range ctrList {
+		if len(ctr.Names) > 0 {
+			names[ctr.ID] = ctr.Names[0]
+		}
+	}
+	if containerID != "" {
+		contData, err := containersInspect(ctx, containerID, &containers.InspectOptions{})
+		if err != nil {
+			return objects, err
+		}
+		containerID = contData.ID
+	}
+
+	programs, err := bpfListPrograms()
+	if err != nil {
+		return objects, err
+	}
+	maps, err := bpfListMaps()
+	if err != nil {
+		return objects, err
+	}
+	links, err := bpfListLinks()
+	if err != nil {
+		return objects, err
+	}
+
+	attachPoints := map[uint32][]string{}
+	for _, l := range links {
+		attachPoints[l.ProgID] = append(attachPoints[l.ProgID], l.AttachPoint())
+	}
+
+	selectedProgs := map[uint32]bool{}
+	selectedMaps := map[uint32]bool{}
+	for _, p := range programs {
+		owners := bpfOwners(p.PIDs, names)
+		if containerID != "" && !ownedBy(owners, containerID) {
+			continue
+		}
+		selectedProgs[p.ID] = true
+		for _, id := range p.MapIDs {
+			selectedMaps[id] = true
+		}
+		prog := BPFProgram{
+			ID:           p.ID,
+			Type:         p.Type,
+			Name:         p.Name,
+			Tag:          p.Tag,
+			AttachPoints: attachPoints[p.ID],
+			Memory:       p.Memory,
+			LoadedAt:     p.LoadedAt,
+			MapIDs:       p.MapIDs,
+			Owners:       owners,
+		}
+		if prog.AttachPoints == nil {
+			prog.AttachPoints = []string{}
+		}
+		if prog.MapIDs == nil {
+			prog.MapIDs = []uint32{}
+		}
+		objects.Programs = append(objects.Programs, prog)
+	}
+	for _, m := range maps {
+		owners := bpfOwners(m.PIDs, names)
+		if containerID != "" && !selectedMaps[m.ID] && !ownedBy(owners, containerID) {
+			continue
+		}
+		objects.Maps = append(objects.Maps, BPFMap{
+			ID:         m.ID,
+			Type:       m.Type,
+			Name:       m.Name,
+			KeySize:    m.KeySize,
+			ValueSize:  m.ValueSize,
+			MaxEntries: m.MaxEntries,
+			Memory:     m.Memory,
+			Owners:     owners,
+		})
+	}
+	for _, l := range links {
+		owners := bpfOwners(l.PIDs, names)
+		if containerID != "" && !selectedProgs[l.ProgID] && !ownedBy(owners, containerID) {
+			continue
+		}
+		objects.Links = append(objects.Links, BPFLink{
+			ID:          l.ID,
+			Type:        l.Type,
+			ProgramID:   l.ProgID,
+			AttachPoint: l.AttachPoint(),
+			Owners:      owners,
+		})
+	}
+	return objects, nil
+}
+
+// MapDumpRequest selects a map by ID or by its pinned path inside the
+// container, and a page of its entries.
+type MapDumpRequest struct {
+	ID     uint32
+	Pinned string
+	Offset int
+	// 0 uses the default page size of 100
+	Limit int
+}
+
+type BPFMapDump struct {
+	Map     BPFMap         `json:"map"`
+	Total   int            `json:"total"`
+	Offset  int            `json:"offset"`
+	Limit   int            `json:"limit"`
+	Entries []bpf.MapEntry `json:"entries"`
+}
+
+func (r MapDumpRequest) Validate() error {
+	if (r.ID == 0) == (r.Pinned == "") {
+		return fmt.Errorf("either a map id or a pinned path is required")
+	}
+	if r.Pinned != "" {
+		if !path.IsAbs(r.Pinned) || path.Clean(r.Pinned) != r.Pinned || !strings.HasPrefix(r.Pinned, bpffsRoot+"/") {
+			return fmt.Errorf("pinned path must be a clean path below %s", bpffsRoot)
+		}
+	}
+	if r.Offset < 0 || r.Limit < 0 || r.Limit > maxMapDumpPage {
+		return fmt.Errorf("offset must not be negative and limit must be between 0 and %d", maxMapDumpPage)
+	}
+	return nil
+}
+
+// DumpBPFMap returns a page of the entries of a map owned by a container.
+// Maps pinned in the container's bpf filesystem count as owned, maps given
+// by ID must be held by one of its processes or used by one of its programs.
+func DumpBPFMap(ctx context.Context, containerID string, req MapDumpRequest) (BPFMapDump, error) {
+	dump := BPFMapDump{Offset: req.Offset, Limit: req.Limit, Entries: []bpf.MapEntry{}}
+	if dump.Limit == 0 {
+		dump.Limit = defaultMapDumpPage
+	}
+	if err := req.Validate(); err != nil {
+		return dump, err
+	}
+
+	mapID := req.ID
+	if req.Pinned != "" {
+		root, err := containerRoot(ctx, containerID)
+		if err != nil {
+			return dump, err
+		}
+		// symlinks are resolved inside the container root, bpftool gets the
+		// opened file so nothing is resolved against the host's root
+		handle, err := securejoin.OpenInRoot(root, req.Pinned)
+		if err != nil {
+			return dump, fmt.Errorf("%s is not a pinned map in the container", req.Pinned)
+		}
+		m, err := bpfPinnedMapInfo(fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), handle.Fd()))
+		handle.Close()
+		if err != nil {
+			return dump, err
+		}
+		mapID = m.ID
+	} else {
+		objects, err := GetBPFObjects(ctx, containerID)
+		if err != nil {
+			return dump, err
+		}
+		owned := false
+		for _, m := range objects.Maps {
+			owned = owned || m.ID == mapID
+		}
+		if !owned {
+			return dump, fmt.Errorf("map %d: %w", mapID, ErrMapNotOwned)
+		}
+	}
+
+	m, err := bpfMapInfo(mapID)
+	if err != nil {
+		return dump, err
+	}
+	dump.Map = BPFMap{
+		ID:         m.ID,
+		Type:       m.Type,
+		Name:       m.Name,
+		KeySize:    m.KeySize,
+		ValueSize:  m.ValueSize,
+		MaxEntries: m.MaxEntries,
+		Memory:     m.Memory,
+		Owners:     bpfOwners(m.PIDs, nil),
+	}
+	entries, err := bpfDumpMap(mapID)
+	if err != nil {
+		return dump, err
+	}
+	dump.Total = len(entries)
+	if dump.Offset < len(entries) {
+		end := min(dump.Offset+dump.Limit, len(entries))
+		dump.Entries = entries[dump.Offset:end]
+	}
+	return dump, nil
+}
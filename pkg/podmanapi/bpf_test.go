@@ -0,0 +1,167 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+	"github.com/sonarping/go-nodeapi/pkg/bpf"
+)
+
+func TestGetBPFObjects(t *testing.T) {
+	origList := containersList
+	origInspect := containersInspect
+	origProc := procRoot
+	origProgs, origMaps, origLinks := bpfListPrograms, bpfListMaps, bpfListLinks
+	defer func() {
+		containersList = origList
+		containersInspect = origInspect
+		procRoot = origProc
+		bpfListPrograms, bpfListMaps, bpfListLinks = origProgs, origMaps, origLinks
+	}()
+
+	ctrID := strings.Repeat("ab", 32)
+	procRoot = t.TempDir()
+	cgroups := map[string]string{
+		"100": "0::/machine.slice/libpod-" + ctrID + ".scope/container/system.slice/ebpf_trace.service\n",
+		"200": "0::/system.slice/sshd.service\n",
+	}
+	for pid, cgroup := range cgroups {
+		os.MkdirAll(filepath.Join(procRoot, pid), 0755)
+		os.WriteFile(filepath.Join(procRoot, pid, "cgroup"), []byte(cgroup), 0644)
+	}
+
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return []entitiesTypes.ListContainer{{ID: ctrID, Names: []string{"env1"}}}, nil
+	}
+	containersInspect = func(ctx context.Context, nameOrID string, _ *containers.InspectOptions) (*define.InspectContainerData, error) {
+		return &define.InspectContainerData{ID: ctrID, Name: "env1"}, nil
+	}
+	bpfListPrograms = func() ([]bpf.Program, error) {
+		return []bpf.Program{
+			{ID: 1, Type: "kprobe", Name: "trace_open", MapIDs: []uint32{10}, PIDs: []bpf.Process{{PID: 100, Comm: "trace"}}},
+			{ID: 2, Type: "cgroup_skb", Name: "host", PIDs: []bpf.Process{{PID: 200, Comm: "sshd"}}},
+		}, nil
+	}
+	bpfListMaps = func() ([]bpf.Map, error) {
+		return []bpf.Map{{ID: 10, Type: "hash", Name: "counts"}, {ID: 11, Type: "array", Name: "other"}}, nil
+	}
+	bpfListLinks = func() ([]bpf.Link, error) {
+		return []bpf.Link{{ID: 5, Type: "perf_event", ProgID: 1, AttachType: "kprobe", FuncName: "do_sys_openat2"}}, nil
+	}
+
+	all, err := GetBPFObjects(context.Background(), "")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(all.Programs) != 2 || len(all.Maps) != 2 || len(all.Links) != 1 {
+		t.Fatalf("expected all objects, got: %#v", all)
+	}
+	if all.Programs[1].Owners[0].ID != "" {
+		t.Errorf("expected host process not to be attributed, got: %#v", all.Programs[1].Owners)
+	}
+
+	objects, err := GetBPFObjects(context.Background(), "env1")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(objects.Programs) != 1 || len(objects.Maps) != 1 || len(objects.Links) != 1 {
+		t.Fatalf("expected only env1's objects, got: %#v", objects)
+	}
+	owner := objects.Programs[0].Owners[0]
+	if owner.Container != "env1" || owner.Unit != "ebpf_trace.service" || owner.PID != 100 {
+		t.Errorf("unexpected owner: %#v", owner)
+	}
+	if ap := objects.Programs[0].AttachPoints; len(ap) != 1 || ap[0] != "kprobe do_sys_openat2" {
+		t.Errorf("unexpected attach points: %v", ap)
+	}
+}
+
+func TestDumpBPFMap(t *testing.T) {
+	withFakeSystemd(t, &fakeSystemd{})
+	origList := containersList
+	origProgs, origMaps, origLinks := bpfListPrograms, bpfListMaps, bpfListLinks
+	origInfo, origPinned, origDump := bpfMapInfo, bpfPinnedMapInfo, bpfDumpMap
+	defer func() {
+		containersList = origList
+		bpfListPrograms, bpfListMaps, bpfListLinks = origProgs, origMaps, origLinks
+		bpfMapInfo, bpfPinnedMapInfo, bpfDumpMap = origInfo, origPinned, origDump
+	}()
+
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return nil, nil
+	}
+	bpfListPrograms = func() ([]bpf.Program, error) { return nil, nil }
+	bpfListLinks = func() ([]bpf.Link, error) { return nil, nil }
+	bpfListMaps = func() ([]bpf.Map, error) {
+		return []bpf.Map{{ID: 10, Name: "counts"}}, nil
+	}
+	bpfMapInfo = func(id uint32) (bpf.Map, error) {
+		return bpf.Map{ID: id, Name: "counts", Type: "hash"}, nil
+	}
+	bpfDumpMap = func(id uint32) ([]bpf.MapEntry, error) {
+		entries := []bpf.MapEntry{}
+		for i := 0; i < 5; i++ {
+			entries = append(entries, bpf.MapEntry{Key: fmt.Sprintf("%02x", i), Value: "00"})
+		}
+		return entries, nil
+	}
+
+	// the fake container has no processes, so map 10 is not its own
+	if _, err := DumpBPFMap(context.Background(), "abc", MapDumpRequest{ID: 10}); !errors.Is(err, ErrMapNotOwned) {
+		t.Fatalf("expected ErrMapNotOwned, got: %v", err)
+	}
+
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return []entitiesTypes.ListContainer{{ID: strings.Repeat("0", 64), Names: []string{"env1"}}}, nil
+	}
+	origProc := procRoot
+	defer func() { procRoot = origProc }()
+	procRoot = t.TempDir()
+	os.MkdirAll(filepath.Join(procRoot, "100"), 0755)
+	os.WriteFile(filepath.Join(procRoot, "100", "cgroup"), []byte("0::/machine.slice/libpod-"+strings.Repeat("0", 64)+".scope\n"), 0644)
+	bpfListMaps = func() ([]bpf.Map, error) {
+		return []bpf.Map{{ID: 10, Name: "counts", PIDs: []bpf.Process{{PID: 100}}}}, nil
+	}
+
+	dump, err := DumpBPFMap(context.Background(), strings.Repeat("0", 64), MapDumpRequest{ID: 10, Offset: 3, Limit: 10})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if dump.Total != 5 || len(dump.Entries) != 2 || dump.Entries[0].Key != "03" || dump.Map.Name != "counts" {
+		t.Errorf("unexpected dump: %#v", dump)
+	}
+
+	// pinned in the container, reached through a symlink absolute inside it
+	root := filepath.Join(procRoot, "4242", "root")
+	os.MkdirAll(filepath.Join(root, "sys/fs/bpf/trace"), 0755)
+	os.WriteFile(filepath.Join(root, "sys/fs/bpf/trace/counts"), nil, 0600)
+	os.Symlink("/sys/fs/bpf/trace", filepath.Join(root, "sys/fs/bpf/current"))
+	pinned, _ := os.Stat(filepath.Join(root, "sys/fs/bpf/trace/counts"))
+	bpfPinnedMapInfo = func(p string) (bpf.Map, error) {
+		if fi, err := os.Stat(p); err != nil || !os.SameFile(fi, pinned) {
+			return bpf.Map{}, fmt.Errorf("unexpected pinned path %s", p)
+		}
+		return bpf.Map{ID: 10}, nil
+	}
+	dump, err = DumpBPFMap(context.Background(), "abc", MapDumpRequest{Pinned: "/sys/fs/bpf/current/counts"})
+	if err != nil || dump.Map.ID != 10 || dump.Total != 5 {
+		t.Errorf("expected the pinned map to be dumped, got: %#v, %v", dump, err)
+	}
+	if _, err := DumpBPFMap(context.Background(), "abc", MapDumpRequest{Pinned: "/sys/fs/bpf/missing"}); err == nil {
+		t.Errorf("expected a missing pin to be rejected")
+	}
+
+	for _, req := range []MapDumpRequest{{}, {ID: 1, Pinned: "/sys/fs/bpf/x"}, {Pinned: "/etc/passwd"}, {Pinned: "/sys/fs/bpf/../x"}, {ID: 1, Limit: 5000}} {
+		if err := req.Validate(); err == nil {
+			t.Errorf("expected %#v to be rejected", req)
+		}
+	}
+}
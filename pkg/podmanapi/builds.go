@@ -0,0 +1,362 @@
+package podmanapi
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	BuildStatusRunning   = "running"
+	BuildStatusSucceeded = "succeeded"
+	BuildStatusFailed    = "failed"
+
+	// finished builds are forgotten after this long
+	buildRetention = 24 * time.Hour
+)
+
+// ImageBuild is the pollable state of an asynchronous image build.
+type ImageBuild struct {
+	ID         string     `json:"build_id"`
+	Status     string     `json:"status"`
+	Tags       []string   `json:"tags"`
+	ImageID    string     `json:"image_id,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImageBuildRequest is an image build as uploaded by a client. Context is an
+// optional (optionally gzipped) tarball; Dockerfile may be empty when the
+// context already contains a Dockerfile at its root.
+type ImageBuildRequest struct {
+	Dockerfile []byte
+	Context    io.Reader
+	Tags       []string
+	BuildArgs  map[string]string
+	Target     string
+	NoCache    bool
+	Squash     bool
+}
+
+// buildJob tracks one build and the output it produced so far. Waiters block on
+// changed, which is closed and replaced whenever output or state changes.
+type buildJob struct {
+	mu      sync.Mutex
+	info    ImageBuild
+	output  bytes.Buffer
+	changed chan struct{}
+}
+
+func (j *buildJob) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.output.Write(p)
+	j.notify()
+	return len(p), nil
+}
+
+// notify wakes up all waiters, j.mu must be held.
+func (j *buildJob) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+func (j *buildJob) finish(imageID string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.info.FinishedAt = &now
+	j.info.ImageID = imageID
+	if err != nil {
+		j.info.Status = BuildStatusFailed
+		j.info.Error = err.Error()
+	} else {
+		j.info.Status = BuildStatusSucceeded
+	}
+	j.notify()
+}
+
+var (
+	buildsMu sync.Mutex
+	builds   = map[string]*buildJob{}
+)
+
+// StartImageBuild unpacks the build context and starts the build in the
+// background. The returned build can be polled with GetImageBuild.
+func StartImageBuild(ctx context.Context, req ImageBuildRequest) (ImageBuild, error) {
+	if len(req.Tags) == 0 {
+		return ImageBuild{}, fmt.Errorf("at least one tag is required")
+	}
+	// the uploaded Dockerfile is kept next to the context, never in it
+	workDir, err := os.MkdirTemp("", "abra-build-")
+	if err != nil {
+		return ImageBuild{}, fmt.Errorf("error creating build context: %v", err)
+	}
+	contextDir := filepath.Join(workDir, "context")
+	if err := os.Mkdir(contextDir, 0755); err != nil {
+		os.RemoveAll(workDir)
+		return ImageBuild{}, fmt.Errorf("error creating build context: %v", err)
+	}
+	if req.Context != nil {
+		if err := extractTarball(req.Context, contextDir); err != nil {
+			os.RemoveAll(workDir)
+			return ImageBuild{}, fmt.Errorf("error extracting build context: %v", err)
+		}
+	}
+	dockerfile := "Dockerfile"
+	if len(req.Dockerfile) > 0 {
+		dockerfile = filepath.Join(workDir, "Dockerfile")
+		if err := os.WriteFile(dockerfile, req.Dockerfile, 0644); err != nil {
+			os.RemoveAll(workDir)
+			return ImageBuild{}, fmt.Errorf("error writing Dockerfile: %v", err)
+		}
+	} else if _, err := os.Stat(filepath.Join(contextDir, dockerfile)); err != nil {
+		os.RemoveAll(workDir)
+		return ImageBuild{}, fmt.Errorf("no Dockerfile uploaded and none found in build context")
+	}
+
+	id, err := newBuildID()
+	if err != nil {
+		os.RemoveAll(workDir)
+		return ImageBuild{}, err
+	}
+	job := &buildJob{
+		info: ImageBuild{
+			ID:        id,
+			Status:    BuildStatusRunning,
+			Tags:      req.Tags,
+			StartedAt: time.Now(),
+		},
+		changed: make(chan struct{}),
+	}
+	buildsMu.Lock()
+	forgetOldBuilds()
+	builds[id] = job
+	buildsMu.Unlock()
+
+	opts := ImageBuildOptions{
+		ContextDir: contextDir,
+		Dockerfile: dockerfile,
+		Tags:       req.Tags,
+		BuildArgs:  req.BuildArgs,
+		Target:     req.Target,
+		NoCache:    req.NoCache,
+		Squash:     req.Squash,
+	}
+	go func() {
+		defer os.RemoveAll(workDir)
+		imageID, err := BuildImage(ctx, opts, job)
+		if err != nil {
+			log.Printf("Build %s failed: %v", id, err)
+		}
+		job.finish(imageID, err)
+	}()
+
+	return job.info, nil
+}
+
+// GetImageBuild returns the current state of a build.
+func GetImageBuild(id string) (ImageBuild, error) {
+	job, err := lookupBuild(id)
+	if err != nil {
+		return ImageBuild{}, err
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.info, nil
+}
+
+// ListImageBuilds returns all builds that are still being tracked.
+func ListImageBuilds() []ImageBuild {
+	buildsMu.Lock()
+	defer buildsMu.Unlock()
+	ret := make([]ImageBuild, 0, len(builds))
+	for _, job := range builds {
+		job.mu.Lock()
+		ret = append(ret, job.info)
+		job.mu.Unlock()
+	}
+	return ret
+}
+
+// StreamImageBuild copies the output of a build to w. When follow is set it
+// keeps writing new output until the build finishes or ctx is cancelled.
+func StreamImageBuild(ctx context.Context, id string, w io.Writer, follow bool) error {
+	job, err := lookupBuild(id)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	for {
+		job.mu.Lock()
+		chunk := append([]byte(nil), job.output.Bytes()[offset:]...)
+		running := job.info.Status == BuildStatusRunning
+		changed := job.changed
+		job.mu.Unlock()
+
+		if len(chunk) > 0 {
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+			if f, ok := w.(interface{ Flush() }); ok {
+				f.Flush()
+			}
+			offset += len(chunk)
+		}
+		if !follow || !running {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func lookupBuild(id string) (*buildJob, error) {
+	buildsMu.Lock()
+	defer buildsMu.Unlock()
+	job, ok := builds[id]
+	if !ok {
+		return nil, fmt.Errorf("build %s not found", id)
+	}
+	return job, nil
+}
+
+// forgetOldBuilds drops finished builds past their retention, buildsMu must be held.
+func forgetOldBuilds() {
+	for id, job := range builds {
+		job.mu.Lock()
+		expired := job.info.FinishedAt != nil && time.Since(*job.info.FinishedAt) > buildRetention
+		job.mu.Unlock()
+		if expired {
+			delete(builds, id)
+		}
+	}
+}
+
+func newBuildID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate build ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// extractTarball unpacks a plain or gzipped tar stream into dest, rejecting
+// entries that would escape it. Parent directories are resolved inside dest,
+// so symlinks from earlier entries are never followed out of it.
+func extractTarball(r io.Reader, dest string) error {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		src = gz
+	}
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, hdr.Name)
+		if target != dest && !strings.HasPrefix(target, dest+string(filepath.Separator)) {
+			return fmt.Errorf("illegal path in archive: %s", hdr.Name)
+		}
+		if target == dest {
+			continue
+		}
+		name, err := filepath.Rel(dest, target)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := securejoin.MkdirAll(dest, name, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			err := withParentDir(dest, name, func(dir *os.File, base string) error {
+				// a later entry replaces an earlier one, never writes through it
+				if err := unix.Unlinkat(int(dir.Fd()), base, 0); err != nil && err != unix.ENOENT && err != unix.EISDIR {
+					return err
+				}
+				fd, err := unix.Openat(int(dir.Fd()), base, unix.O_CREAT|unix.O_EXCL|unix.O_WRONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, uint32(hdr.Mode)&0777)
+				if err != nil {
+					return fmt.Errorf("failed to create %s: %w", hdr.Name, err)
+				}
+				f := os.NewFile(uintptr(fd), target)
+				if _, err := io.Copy(f, tr); err != nil {
+					f.Close()
+					return err
+				}
+				return f.Close()
+			})
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			err := withParentDir(dest, name, func(dir *os.File, base string) error {
+				parent, err := securejoin.SecureJoin(dest, filepath.Dir(name))
+				if err != nil {
+					return err
+				}
+				linkTarget := filepath.Join(parent, hdr.Linkname)
+				if filepath.IsAbs(hdr.Linkname) || (linkTarget != dest && !strings.HasPrefix(linkTarget, dest+string(filepath.Separator))) {
+					return fmt.Errorf("illegal symlink in archive: %s -> %s", hdr.Name, hdr.Linkname)
+				}
+				return unix.Symlinkat(hdr.Linkname, int(dir.Fd()), base)
+			})
+			if err != nil {
+				return err
+			}
+		default:
+			// devices, fifos and hard links are not needed for a build context
+			log.Printf("Skipping unsupported archive entry %s", hdr.Name)
+		}
+	}
+}
+
+// withParentDir creates the parent directories of name inside root and calls
+// fn with the parent opened and the last path element.
+func withParentDir(root string, name string, fn func(dir *os.File, base string) error) error {
+	parent := filepath.Dir(name)
+	if err := securejoin.MkdirAll(root, parent, 0755); err != nil {
+		return err
+	}
+	handle, err := securejoin.OpenInRoot(root, parent)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	dir, err := securejoin.Reopen(handle, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return fn(dir, filepath.Base(name))
+}
@@ -0,0 +1,174 @@
+package podmanapi
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
+)
+
+func makeTarball(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestExtractTarball_RejectsTraversal(t *testing.T) {
+	dest := t.TempDir()
+	err := extractTarball(makeTarball(t, map[string]string{"../evil": "x"}), dest)
+	if err == nil || !strings.Contains(err.Error(), "illegal path") {
+		t.Fatalf("expected illegal path error, got: %v", err)
+	}
+}
+
+func TestExtractTarball_SymlinkEscape(t *testing.T) {
+	base := t.TempDir()
+	dest := filepath.Join(base, "a", "b", "ctx")
+	os.MkdirAll(dest, 0755)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "a/b/d", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "a/b/d/x", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+		{Name: "a/b/d/x/pwned", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+	} {
+		tw.WriteHeader(hdr)
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte("x"))
+		}
+	}
+	tw.Close()
+
+	err := extractTarball(buf, dest)
+	if err == nil || !strings.Contains(err.Error(), "illegal symlink") {
+		t.Errorf("expected illegal symlink error, got: %v", err)
+	}
+	filepath.Walk(base, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.Name() == "pwned" && !strings.HasPrefix(p, dest+string(filepath.Separator)) {
+			t.Errorf("file written outside of the build context: %s", p)
+		}
+		return nil
+	})
+}
+
+func TestExtractTarball_Symlinks(t *testing.T) {
+	dest := t.TempDir()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "self", Typeflag: tar.TypeSymlink, Linkname: "."},
+		{Name: "up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "up/file", Typeflag: tar.TypeReg, Mode: 0644, Size: 2},
+	} {
+		tw.WriteHeader(hdr)
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte("ok"))
+		}
+	}
+	tw.Close()
+
+	err := extractTarball(buf, dest)
+	if err == nil || !strings.Contains(err.Error(), "illegal symlink in archive: up") {
+		t.Fatalf("expected only the symlink out of the context to be rejected, got: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "self")); err != nil || target != "." {
+		t.Errorf("expected self -> ., got: %q, %v", target, err)
+	}
+}
+
+func TestStartImageBuild_Success(t *testing.T) {
+	origBuild := imagesBuild
+	defer func() { imagesBuild = origBuild }()
+
+	var gotOpts types.BuildOptions
+	var gotFiles []string
+	imagesBuild = func(ctx context.Context, containerFiles []string, options types.BuildOptions) (*types.BuildReport, error) {
+		gotOpts = options
+		gotFiles = containerFiles
+		if data, err := os.ReadFile(containerFiles[0]); err != nil || string(data) != "FROM scratch\n" {
+			return nil, errors.New("uploaded Dockerfile not written")
+		}
+		entries, _ := os.ReadDir(options.ContextDirectory)
+		if len(entries) != 2 {
+			return nil, fmt.Errorf("expected the context to be left as uploaded, got %d files", len(entries))
+		}
+		data, err := os.ReadFile(filepath.Join(options.ContextDirectory, "app.txt"))
+		if err != nil || string(data) != "hello" {
+			return nil, errors.New("context not extracted")
+		}
+		options.Out.Write([]byte("STEP 1/1: FROM scratch\n"))
+		return &types.BuildReport{ID: "abc123"}, nil
+	}
+
+	build, err := StartImageBuild(context.Background(), ImageBuildRequest{
+		Dockerfile: []byte("FROM scratch\n"),
+		// the context's own Dockerfile is not the one built
+		Context:   makeTarball(t, map[string]string{"app.txt": "hello", "Dockerfile": "FROM alpine\n"}),
+		Tags:      []string{"lab:latest", "lab:v1"},
+		BuildArgs: map[string]string{"FOO": "bar"},
+		NoCache:   true,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	var out bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := StreamImageBuild(ctx, build.ID, &out, true); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !strings.Contains(out.String(), "STEP 1/1") {
+		t.Errorf("expected build output, got: %q", out.String())
+	}
+
+	final, err := GetImageBuild(build.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if final.Status != BuildStatusSucceeded || final.ImageID != "abc123" {
+		t.Fatalf("expected succeeded build with image abc123, got: %#v", final)
+	}
+	if gotOpts.Output != "lab:latest" || len(gotOpts.AdditionalTags) != 1 || gotOpts.AdditionalTags[0] != "lab:v1" {
+		t.Errorf("unexpected tags: %q %q", gotOpts.Output, gotOpts.AdditionalTags)
+	}
+	if !gotOpts.NoCache || gotOpts.Args["FOO"] != "bar" {
+		t.Errorf("build options not passed through: %#v", gotOpts.Args)
+	}
+	if len(gotFiles) != 1 || !filepath.IsAbs(gotFiles[0]) || strings.HasPrefix(gotFiles[0], gotOpts.ContextDirectory+"/") {
+		t.Errorf("expected the uploaded Dockerfile outside the context, got: %v", gotFiles)
+	}
+}
+
+func TestStartImageBuild_NoDockerfile(t *testing.T) {
+	_, err := StartImageBuild(context.Background(), ImageBuildRequest{
+		Context: makeTarball(t, map[string]string{"app.txt": "hello"}),
+		Tags:    []string{"lab:latest"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no Dockerfile") {
+		t.Fatalf("expected missing Dockerfile error, got: %v", err)
+	}
+}
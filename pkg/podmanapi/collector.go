@@ -0,0 +1,511 @@
+package podmanapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/podman/v5/libpod/define"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	defaultOutputFileBytes = 10 * 1024 * 1024
+	defaultOutputFiles     = 5
+)
+
+// collector configs are kept per container name like bandwidth limits, the
+// collected output per job (container name) below ebpfOutputDir
+var (
+	collectorMu        sync.Mutex
+	collectorStatePath = "/var/lib/abra/ebpf_collectors.json"
+	ebpfOutputDir      = "/var/lib/abra/ebpf-output"
+)
+
+// Dependency injection variables for testing:
+var collectorPollInterval = time.Second
+
+var outputNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// OutputSource is output of an ebpf_ unit to collect: a file inside the
+// container, or what the unit prints (e.g. a perf or ring buffer reader)
+// when Path is empty.
+type OutputSource struct {
+	Unit string `json:"unit"`
+	Path string `json:"path,omitempty"`
+}
+
+// CollectorConfig selects the output collected from a container.
+type CollectorConfig struct {
+	Sources []OutputSource `json:"sources"`
+	// size at which an output file is rotated, 0 uses 10MiB
+	MaxFileBytes int64 `json:"max_file_bytes"`
+	// rotated files kept per source, 0 uses 5
+	MaxFiles int `json:"max_files"`
+	// keep the output when the container is removed
+	Keep bool `json:"keep"`
+}
+
+// OutputFile is a collected output file of a job.
+type OutputFile struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	ModifiedAt int64  `json:"modified_at"`
+}
+
+func (c CollectorConfig) Validate() error {
+	seen := map[string]bool{}
+	for _, s := range c.Sources {
+		if _, err := ebpfUnitName(s.Unit); err != nil {
+			return err
+		}
+		if s.Path != "" && (!path.IsAbs(s.Path) || path.Clean(s.Path) != s.Path) {
+			return fmt.Errorf("output path %q must be a clean absolute path", s.Path)
+		}
+		if seen[s.fileName()] {
+			return fmt.Errorf("output of %s %s is collected twice", s.Unit, s.Path)
+		}
+		seen[s.fileName()] = true
+	}
+	if c.MaxFileBytes < 0 || c.MaxFiles < 0 {
+		return fmt.Errorf("max_file_bytes and max_files must not be negative")
+	}
+	return nil
+}
+
+func (c CollectorConfig) withDefaults() CollectorConfig {
+	if c.MaxFileBytes == 0 {
+		c.MaxFileBytes = defaultOutputFileBytes
+	}
+	if c.MaxFiles == 0 {
+		c.MaxFiles = defaultOutputFiles
+	}
+	return c
+}
+
+// fileName is the host side output file, e.g. ebpf_trace.log or
+// ebpf_trace-events.json.log.
+func (s OutputSource) fileName() string {
+	name := strings.TrimSuffix(s.Unit, ".service")
+	if s.Path != "" {
+		name += "-" + outputNameRegexp.ReplaceAllString(path.Base(s.Path), "_")
+	}
+	return name + ".log"
+}
+
+func validJobName(job string) error {
+	if job == "" || job != filepath.Base(job) || job == "." || job == ".." {
+		return fmt.Errorf("invalid job %q", job)
+	}
+	return nil
+}
+
+func loadCollectorConfigs() (map[string]CollectorConfig, error) {
+	configs := map[string]CollectorConfig{}
+	if err := readState(collectorStatePath, &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// storeCollectorConfig remembers the config of a container, no sources forget it.
+func storeCollectorConfig(name string, config CollectorConfig) error {
+	collectorMu.Lock()
+	defer collectorMu.Unlock()
+	configs, err := loadCollectorConfigs()
+	if err != nil {
+		return err
+	}
+	if _, ok := configs[name]; !ok && len(config.Sources) == 0 {
+		return nil
+	}
+	if len(config.Sources) == 0 {
+		delete(configs, name)
+	} else {
+		configs[name] = config
+	}
+	return writeState(collectorStatePath, configs)
+}
+
+func storedCollectorConfig(name string) (CollectorConfig, bool, error) {
+	collectorMu.Lock()
+	defer collectorMu.Unlock()
+	configs, err := loadCollectorConfigs()
+	if err != nil {
+		return CollectorConfig{}, false, err
+	}
+	config, ok := configs[name]
+	return config, ok, nil
+}
+
+// GetCollectorConfig returns the output collected from a container.
+func GetCollectorConfig(ctx context.Context, containerID string) (CollectorConfig, error) {
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return CollectorConfig{}, err
+	}
+	config, _, err := storedCollectorConfig(inspectData.Name)
+	if config.Sources == nil {
+		config.Sources = []OutputSource{}
+	}
+	return config, err
+}
+
+// SetCollectorConfig stores what to collect from a container and restarts
+// its collectors if it is running. No sources stop collecting.
+func SetCollectorConfig(ctx context.Context, containerID string, config CollectorConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return err
+	}
+	if err := storeCollectorConfig(inspectData.Name, config); err != nil {
+		return err
+	}
+	return StartOutputCollectors(ctx, containerID)
+}
+
+// collection is the set of goroutines collecting the output of one container.
+type collection struct {
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+var (
+	collectionsMu sync.Mutex
+	collections   = map[string]*collection{}
+	// container start and network events start collecting concurrently
+	collectorStart keyedMutex
+)
+
+// stopCollection stops collecting for a container and waits until the
+// collectors have flushed their output.
+func stopCollection(name string) {
+	collectionsMu.Lock()
+	c := collections[name]
+	delete(collections, name)
+	collectionsMu.Unlock()
+	if c != nil {
+		c.cancel()
+		c.done.Wait()
+	}
+}
+
+// StartOutputCollectors (re)starts collecting the configured output of a
+// running container. Collectors stop by themselves when the container stops.
+func StartOutputCollectors(ctx context.Context, containerID string) error {
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return err
+	}
+	name := inspectData.Name
+	defer collectorStart.lock(name)()
+	stopCollection(name)
+	config, ok, err := storedCollectorConfig(name)
+	if err != nil || !ok || inspectData.State.Status != define.ContainerStateRunning.String() {
+		return err
+	}
+	config = config.withDefaults()
+	jobDir := filepath.Join(ebpfOutputDir, name)
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output dir: %w", err)
+	}
+
+	collectCtx, cancel := context.WithCancel(context.Background())
+	c := &collection{cancel: cancel}
+	collectionsMu.Lock()
+	collections[name] = c
+	collectionsMu.Unlock()
+
+	root := filepath.Join(procRoot, strconv.Itoa(inspectData.State.Pid), "root")
+	for _, source := range config.Sources {
+		w := &rotatingWriter{path: filepath.Join(jobDir, source.fileName()), maxBytes: config.MaxFileBytes, maxFiles: config.MaxFiles}
+		c.done.Add(1)
+		go func(source OutputSource) {
+			defer c.done.Done()
+			defer w.Close()
+			var err error
+			if source.Path == "" {
+				err = collectUnitOutput(collectCtx, root, source, w)
+			} else {
+				err = collectFile(collectCtx, root, source, w)
+			}
+			if err != nil {
+				log.Printf("Error collecting output of %s in %s: %v", source.Unit, name, err)
+			}
+		}(source)
+	}
+	return nil
+}
+
+// collectUnitOutput follows what the unit writes to the journal, resuming
+// after the last collected entry.
+func collectUnitOutput(ctx context.Context, root string, source OutputSource, w *rotatingWriter) error {
+	unit, _ := ebpfUnitName(source.Unit)
+	// journalctl keeps following after the container is gone
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		for {
+			if _, err := os.Stat(root); err != nil {
+				cancel()
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(collectorPollInterval):
+			}
+		}
+	}()
+	args := []string{"--root", root, "--unit", unit, "--no-pager", "--output", "short-iso", "--follow",
+		"--cursor-file", w.path + ".cursor"}
+	return runJournalctlFunc(ctx, args, w)
+}
+
+// collectFile tails a file inside the container. The read offset is kept
+// next to the output so a restart neither loses nor repeats output.
+func collectFile(ctx context.Context, root string, source OutputSource, w *rotatingWriter) error {
+	offsetPath := w.path + ".offset"
+	var offset int64
+	if data, err := os.ReadFile(offsetPath); err == nil {
+		offset, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		// the container's root is gone once it stopped
+		if _, err := os.Stat(root); err != nil {
+			return nil
+		}
+		if f, err := openInContainer(root, source.Path); err == nil {
+			if fi, err := f.Stat(); err == nil && fi.Size() < offset {
+				// truncated or replaced
+				offset = 0
+			}
+			for {
+				n, err := f.ReadAt(buf, offset)
+				if n > 0 {
+					if _, werr := w.Write(buf[:n]); werr != nil {
+						f.Close()
+						return werr
+					}
+					offset += int64(n)
+				}
+				if err != nil {
+					break
+				}
+			}
+			f.Close()
+			if err := os.WriteFile(offsetPath, []byte(strconv.FormatInt(offset, 10)), 0644); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(collectorPollInterval):
+		}
+	}
+}
+
+// openInContainer opens a regular file of the container for reading.
+// Symlinks are resolved inside root, so the container cannot make the daemon
+// read host files.
+func openInContainer(root string, p string) (*os.File, error) {
+	handle, err := securejoin.OpenInRoot(root, p)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	fi, err := handle.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", p)
+	}
+	return securejoin.Reopen(handle, unix.O_RDONLY|unix.O_CLOEXEC)
+}
+
+// rotatingWriter appends to path and rotates it to path.1 ... path.<maxFiles>
+// when it would grow past maxBytes.
+type rotatingWriter struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return 0, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		w.f, w.size = f, fi.Size()
+	}
+	if w.size > 0 && w.size+int64(len(p)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) rotate() error {
+	w.f.Close()
+	w.f = nil
+	os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxFiles))
+	for i := w.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.f, w.size = f, 0
+	return nil
+}
+
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+// isOutputFile tells collected output apart from the collector's bookkeeping.
+func isOutputFile(name string) bool {
+	return !strings.HasSuffix(name, ".offset") && !strings.HasSuffix(name, ".cursor")
+}
+
+// ListOutputFiles lists the collected output of a job, including jobs whose
+// container was removed.
+func ListOutputFiles(job string) ([]OutputFile, error) {
+	if err := validJobName(job); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(ebpfOutputDir, job))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no output collected for %s", job)
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := []OutputFile{}
+	for _, e := range entries {
+		if e.IsDir() || !isOutputFile(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, OutputFile{Name: e.Name(), Size: info.Size(), ModifiedAt: info.ModTime().Unix()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// outputFilePath returns the host path of a collected file of a job.
+func outputFilePath(job string, file string) (string, error) {
+	if err := validJobName(job); err != nil {
+		return "", err
+	}
+	if file == "" || file != filepath.Base(file) || !isOutputFile(file) || file == "." || file == ".." {
+		return "", fmt.Errorf("invalid output file %q", file)
+	}
+	p := filepath.Join(ebpfOutputDir, job, file)
+	if _, err := os.Stat(p); err != nil {
+		return "", fmt.Errorf("output file %s of %s not found", file, job)
+	}
+	return p, nil
+}
+
+// StreamOutputFile writes a collected file to w. With follow it keeps
+// streaming what is appended, across rotations, until ctx is done.
+func StreamOutputFile(ctx context.Context, job string, file string, w io.Writer, follow bool) error {
+	p, err := outputFilePath(job, file)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	for {
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+		if fl, ok := w.(interface{ Flush() }); ok {
+			fl.Flush()
+		}
+		if !follow {
+			return nil
+		}
+		// reopen once the file was rotated away
+		if cur, err := os.Stat(p); err == nil {
+			if fi, err := f.Stat(); err == nil && !os.SameFile(cur, fi) {
+				f.Close()
+				if f, err = os.Open(p); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(collectorPollInterval):
+		}
+	}
+}
+
+// removeCollectedOutput stops collecting for a removed container and drops
+// its output unless it should be kept.
+func removeCollectedOutput(name string) error {
+	stopCollection(name)
+	config, ok, err := storedCollectorConfig(name)
+	if err != nil || !ok {
+		return err
+	}
+	if err := storeCollectorConfig(name, CollectorConfig{}); err != nil {
+		return err
+	}
+	if config.Keep {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(ebpfOutputDir, name))
+}
@@ -0,0 +1,145 @@
+package podmanapi
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriter(t *testing.T) {
+	dir := t.TempDir()
+	w := &rotatingWriter{path: filepath.Join(dir, "ebpf_trace.log"), maxBytes: 10, maxFiles: 2}
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	w.Close()
+
+	expected := map[string]string{
+		"ebpf_trace.log":   "dddddddd\n",
+		"ebpf_trace.log.1": "cccccccc\n",
+		"ebpf_trace.log.2": "bbbbbbbb\n",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != content {
+			t.Errorf("expected %s to contain %q, got: %q, %v", name, content, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ebpf_trace.log.3")); err == nil {
+		t.Errorf("expected only 2 rotated files to be kept")
+	}
+}
+
+func TestCollectFile(t *testing.T) {
+	origInterval := collectorPollInterval
+	defer func() { collectorPollInterval = origInterval }()
+	collectorPollInterval = 10 * time.Millisecond
+
+	root := t.TempDir()
+	out := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "tmp"), 0755)
+	src := filepath.Join(root, "tmp/events.json")
+	os.WriteFile(src, []byte("one\n"), 0644)
+
+	w := &rotatingWriter{path: filepath.Join(out, "ebpf_trace-events.json.log"), maxBytes: 1024, maxFiles: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- collectFile(ctx, root, OutputSource{Unit: "ebpf_trace", Path: "/tmp/events.json"}, w) }()
+
+	time.Sleep(50 * time.Millisecond)
+	f, _ := os.OpenFile(src, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("two\n")
+	f.Close()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	w.Close()
+
+	data, _ := os.ReadFile(w.path)
+	if string(data) != "one\ntwo\n" {
+		t.Errorf("unexpected collected output: %q", data)
+	}
+	offset, _ := os.ReadFile(w.path + ".offset")
+	if string(offset) != "8" {
+		t.Errorf("expected offset 8 to be stored, got: %q", offset)
+	}
+}
+
+func TestCollectFile_SymlinkStaysInContainer(t *testing.T) {
+	origInterval := collectorPollInterval
+	defer func() { collectorPollInterval = origInterval }()
+	collectorPollInterval = 10 * time.Millisecond
+
+	host := t.TempDir()
+	secret := filepath.Join(host, "shadow")
+	os.WriteFile(secret, []byte("root:secret\n"), 0600)
+	root := filepath.Join(host, "container")
+	os.MkdirAll(filepath.Join(root, "var/log"), 0755)
+	// absolute inside the container, pointing at a host file from outside it
+	os.Symlink(secret, filepath.Join(root, "var/log/out"))
+
+	w := &rotatingWriter{path: filepath.Join(t.TempDir(), "ebpf_trace-out.log"), maxBytes: 1024, maxFiles: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- collectFile(ctx, root, OutputSource{Unit: "ebpf_trace", Path: "/var/log/out"}, w) }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	w.Close()
+
+	if data, _ := os.ReadFile(w.path); len(data) != 0 {
+		t.Errorf("expected the host file not to be collected, got: %q", data)
+	}
+}
+
+func TestOutputFiles(t *testing.T) {
+	origDir, origState := ebpfOutputDir, collectorStatePath
+	defer func() { ebpfOutputDir, collectorStatePath = origDir, origState }()
+	ebpfOutputDir = t.TempDir()
+	collectorStatePath = filepath.Join(t.TempDir(), "ebpf_collectors.json")
+
+	jobDir := filepath.Join(ebpfOutputDir, "env1")
+	os.MkdirAll(jobDir, 0755)
+	os.WriteFile(filepath.Join(jobDir, "ebpf_trace.log"), []byte("hello\n"), 0644)
+	os.WriteFile(filepath.Join(jobDir, "ebpf_trace.log.offset"), []byte("6"), 0644)
+
+	files, err := ListOutputFiles("env1")
+	if err != nil || len(files) != 1 || files[0].Name != "ebpf_trace.log" || files[0].Size != 6 {
+		t.Fatalf("unexpected output files: %#v, %v", files, err)
+	}
+	var buf bytes.Buffer
+	if err := StreamOutputFile(context.Background(), "env1", "ebpf_trace.log", &buf, false); err != nil || buf.String() != "hello\n" {
+		t.Errorf("unexpected download: %q, %v", buf.String(), err)
+	}
+	for _, file := range []string{"../env1/ebpf_trace.log", "ebpf_trace.log.offset", "missing.log"} {
+		if err := StreamOutputFile(context.Background(), "env1", file, &buf, false); err == nil {
+			t.Errorf("expected %q to be rejected", file)
+		}
+	}
+	if _, err := ListOutputFiles(".."); err == nil {
+		t.Errorf("expected invalid job to be rejected")
+	}
+
+	// output is dropped with the container unless it should be kept
+	storeCollectorConfig("env1", CollectorConfig{Sources: []OutputSource{{Unit: "ebpf_trace"}}, Keep: true})
+	if err := removeCollectedOutput("env1"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := ListOutputFiles("env1"); err != nil {
+		t.Errorf("expected output to be kept, got: %v", err)
+	}
+	storeCollectorConfig("env1", CollectorConfig{Sources: []OutputSource{{Unit: "ebpf_trace"}}})
+	removeCollectedOutput("env1")
+	if _, err := ListOutputFiles("env1"); err == nil {
+		t.Errorf("expected output to be removed")
+	}
+}
@@ -11,8 +11,9 @@ import (
 	"log"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,6 +25,8 @@ import (
 	"github.com/containers/podman/v5/pkg/domain/entities/types"
 	"github.com/containers/podman/v5/pkg/specgen"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sonarping/go-nodeapi/pkg/netpolicy"
+	"github.com/sonarping/go-nodeapi/pkg/systemd"
 	"github.com/sonarping/go-nodeapi/pkg/utils"
 )
 
@@ -41,6 +44,9 @@ var (
 	containersWait    = containers.Wait
 	containersCreate  = containers.CreateWithSpec
 	containersRemove  = containers.Remove
+
+	dialContainerSystemd = func(pid int) (containerSystemd, error) { return systemd.DialContainer(pid) }
+	reapplyEBPFUnits     = applyDesiredEBPFUnitsAsync
 )
 
 type Container struct {
@@ -68,21 +74,23 @@ func InitPodmanConnection() (context.Context, error) {
 }
 
 type PodmanContainer struct {
-	ID            string   `json:"env_id"`
-	Image         string   `json:"image"`
-	Names         []string `json:"names"`
-	State         string   `json:"state"`
-	StartedAt     int64    `json:"started_at"`
-	Ports         []uint16 `json:"ports"`
-	IP            string   `json:"ip"`
-	Networks      []string `json:"networks"`
-	Exited        bool     `json:"exited"`
-	ExitCode      int32    `json:"exit_code"`
-	ExitedAt      int64    `json:"exited_at"`
-	Status        string   `json:"status"`
-	CPUPercentage float64  `json:"cpu_percentage"`
-	MemoryPercent float64  `json:"memory_percent"`
-	Uptime        int64    `json:"uptime"`
+	ID            string        `json:"env_id"`
+	Image         string        `json:"image"`
+	Names         []string      `json:"names"`
+	State         string        `json:"state"`
+	StartedAt     int64         `json:"started_at"`
+	Ports         []uint16      `json:"ports"`
+	PortMappings  []PortMapping `json:"port_mappings"`
+	IP            string        `json:"ip"`
+	DNSNames      []string      `json:"dns_names"`
+	Networks      []string      `json:"networks"`
+	Exited        bool          `json:"exited"`
+	ExitCode      int32         `json:"exit_code"`
+	ExitedAt      int64         `json:"exited_at"`
+	Status        string        `json:"status"`
+	CPUPercentage float64       `json:"cpu_percentage"`
+	MemoryPercent float64       `json:"memory_percent"`
+	Uptime        int64         `json:"uptime"`
 }
 
 type PodmanContainerStatus struct {
@@ -90,8 +98,31 @@ type PodmanContainerStatus struct {
 	State string `json:"state"`
 }
 type EBPFServiceStatus struct {
-	Name   string `json:"name"`
-	Active bool   `json:"active"`
+	Name        string `json:"name"`
+	Active      bool   `json:"active"`
+	Description string `json:"description"`
+	LoadState   string `json:"load_state"`
+	ActiveState string `json:"active_state"`
+	SubState    string `json:"sub_state"`
+	// unix time of the last state change
+	Since   int64  `json:"since"`
+	MainPID uint32 `json:"main_pid"`
+	// starts when the container boots
+	Enabled       bool   `json:"enabled"`
+	UnitFileState string `json:"unit_file_state"`
+}
+
+// containerSystemd is the part of systemd.Conn used here.
+type containerSystemd interface {
+	ListUnits(pattern string) ([]systemd.UnitStatus, error)
+	UnitStatus(name string) (systemd.UnitStatus, error)
+	Reload() error
+	EnableUnit(name string) error
+	DisableUnit(name string) error
+	StartUnit(name string, timeout time.Duration) (systemd.UnitStatus, error)
+	StopUnit(name string, timeout time.Duration) (systemd.UnitStatus, error)
+	RestartUnit(name string, timeout time.Duration) (systemd.UnitStatus, error)
+	Close() error
 }
 
 func ContainerExec(ctx context.Context, containerID string, command []string) (string, error) {
@@ -142,50 +173,54 @@ func ContainerExec(ctx context.Context, containerID string, command []string) (s
 	return strings.TrimSpace(stdout.String()), nil
 }
 
+// GetEBPFSystemdUnits lists the ebpf_* units of a container by asking its
+// systemd over D-Bus, so the container needs neither findutils nor exec.
 func GetEBPFSystemdUnits(ctx context.Context, containerID string) ([]EBPFServiceStatus, error) {
-	fmt.Println("Getting systemd units...")
-
 	contData, err := containersInspect(ctx, containerID, &containers.InspectOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println(contData.State.Status)
-
 	if contData.State.Status != define.ContainerStateRunning.String() {
 		return nil, fmt.Errorf("Container is not running")
 	}
 
-	command := []string{"find", "/etc/systemd/system", "-maxdepth", "1", "-type", "f", "-name", "ebpf_*", "-printf", "%f\n"}
-	output, err := ContainerExec(ctx, containerID, command)
+	conn, err := dialContainerSystemd(contData.State.Pid)
 	if err != nil {
-		return nil, fmt.Errorf("executing command in container: %w", err)
+		return nil, err
 	}
+	defer conn.Close()
 
-	lines := strings.Split(output, "\n")
-	var files []string
-	for _, l := range lines {
-		if l != "" {
-			files = append(files, l)
-		}
+	units, err := conn.ListUnits("ebpf_*")
+	if err != nil {
+		return nil, err
 	}
-	EBPFServices := make([]EBPFServiceStatus, len(files))
-	for i, f := range files {
-		command = []string{"systemctl", "is-active", f}
-		output, err = ContainerExec(ctx, containerID, command)
-		if err != nil {
-			return nil, fmt.Errorf("executing command in container: %w", err)
-		}
-		fmt.Println(output)
-		status := output == "active"
-		EBPFServices[i] = EBPFServiceStatus{
-			Name:   f,
-			Active: status,
-		}
+	EBPFServices := make([]EBPFServiceStatus, 0, len(units))
+	for _, u := range units {
+		EBPFServices = append(EBPFServices, unitServiceStatus(u))
 	}
 	return EBPFServices, nil
 }
 
+func unitServiceStatus(u systemd.UnitStatus) EBPFServiceStatus {
+	status := EBPFServiceStatus{
+		Name:        u.Name,
+		Active:      u.ActiveState == "active",
+		Description: u.Description,
+		LoadState:   u.LoadState,
+		ActiveState: u.ActiveState,
+		SubState:    u.SubState,
+		MainPID:     u.MainPID,
+		// enabled-runtime links vanish on reboot, so only enabled counts
+		Enabled:       u.UnitFileState == "enabled",
+		UnitFileState: u.UnitFileState,
+	}
+	if !u.Since.IsZero() {
+		status.Since = u.Since.Unix()
+	}
+	return status
+}
+
 func StartEBPFService(ctx context.Context, containerID string, ebpfService string) (bool, error) {
 	fmt.Println("Getting systemd units...")
 
@@ -258,12 +293,20 @@ func ListPodmanContainers(ctx context.Context) ([]PodmanContainer, error) {
 	if err != nil {
 		return nil, err
 	}
+	// DNS names are extra, the containers are still listed without them
+	dnsNetworks, err := dnsEnabledNetworks(ctx)
+	if err != nil {
+		log.Printf("Error listing DNS names of containers: %v", err)
+		dnsNetworks = map[string]bool{}
+	}
 	var ctrStatusList []PodmanContainer
 	for _, ctr := range ctrList {
-		// Retrieve IP
-		ip, err := GetIPAddress(ctx, ctr.ID)
-		if err != nil {
-			ip = ""
+		// Retrieve IP and DNS names
+		ip := ""
+		dnsNames := []string{}
+		if inspectData, err := containersInspect(ctx, ctr.ID, nil); err == nil {
+			ip = ipFromInspect(inspectData)
+			dnsNames = containerDNSNames(inspectData, dnsNetworks)
 		}
 		var stats types.ContainerStatsReport
 		if ctr.State == define.ContainerStateRunning.String() {
@@ -293,8 +336,10 @@ func ListPodmanContainers(ctx context.Context) ([]PodmanContainer, error) {
 			State:         ctr.State,
 			StartedAt:     ctr.StartedAt,
 			Ports:         utils.GetMapKeys(ctr.ExposedPorts),
+			PortMappings:  fromPodmanPorts(ctr.Ports),
 			Networks:      ctr.Networks,
 			IP:            ip,
+			DNSNames:      dnsNames,
 			Exited:        ctr.Exited,
 			ExitCode:      ctr.ExitCode,
 			ExitedAt:      ctr.ExitedAt,
@@ -347,10 +392,23 @@ func StartPodmanContainer(ctx context.Context, containerID string) (PodmanContai
 		return PodmanContainerStatus{}, fmt.Errorf("Timeout waiting for container to start")
 	}
 
+	// the container runs either way, the event watcher reconciles again on
+	// the start event
+	if err := ReconcileNetworkPolicies(ctx); err != nil {
+		log.Printf("Container %s started but its network policy was not applied: %v", containerID, err)
+	}
+	if err := ApplyStoredBandwidth(ctx, containerID); err != nil {
+		log.Printf("Container %s started but its bandwidth limits were not applied: %v", containerID, err)
+	}
+
 	ctrData, err := containersInspect(ctx, containerID, &containers.InspectOptions{})
 	if err != nil {
 		return PodmanContainerStatus{}, err
 	}
+	reapplyEBPFUnits(ctx, containerID, ctrData.Name)
+	if err := StartOutputCollectors(ctx, containerID); err != nil {
+		log.Printf("Error starting output collectors of %s: %v", ctrData.Name, err)
+	}
 
 	return PodmanContainerStatus{
 		ID:    containerID,
@@ -397,6 +455,10 @@ func StopPodmanContainer(ctx context.Context, containerID string) (PodmanContain
 		return PodmanContainerStatus{}, fmt.Errorf("Timeout waiting for container to stop")
 	}
 
+	if err := ReconcileNetworkPolicies(ctx); err != nil {
+		log.Printf("Error reconciling network policies: %v", err)
+	}
+
 	ctrData, err := containersInspect(ctx, containerID, &containers.InspectOptions{})
 	if err != nil {
 		return PodmanContainerStatus{}, err
@@ -408,23 +470,113 @@ func StopPodmanContainer(ctx context.Context, containerID string) (PodmanContain
 	}, nil
 }
 
-func CreateFromImage(ctx context.Context, imageName string, containerName string, static_ip net.IP, CPUs float64, MemLimit int64) (string, error) {
+// CreateOptions holds the settings shared by CreateFromImage and CreateEBPFContainer.
+type CreateOptions struct {
+	// network to join, defaults to DefaultNetwork
+	Network string
+	// address to pin, the next free one on Network when nil
+	StaticIP net.IP
+	// extra names the container resolves by on Network, besides its own name
+	Aliases []string
+	// host ports to publish, checked for conflicts before creating
+	Ports     []PortMapping
+	Bandwidth BandwidthLimits
+	CPUs      float64
+	MemLimit  int64
+	// eBPF containers only: run privileged instead of with Capabilities
+	Privileged bool
+	// subset of CAP_BPF, CAP_PERFMON and CAP_NET_ADMIN, all when empty
+	Capabilities []string
+	// eBPF containers only: mounts to add, the configured default when empty
+	MountProfile string
+}
+
+func (o CreateOptions) network() string {
+	if o.Network == "" {
+		return DefaultNetwork
+	}
+	return o.Network
+}
+
+// pinNetwork attaches spec to the network, leasing the requested or else the
+// next free address for containerName. Only on networks without subnets
+// (e.g. DHCP macvlan) podman assigns the address. The returned func releases
+// the lease if creation fails.
+func pinNetwork(ctx context.Context, spec *specgen.SpecGenerator, containerName string, opts CreateOptions) (func(), error) {
+	if err := ValidateAliases(opts.Aliases); err != nil {
+		return nil, err
+	}
+	if err := checkAliasesResolvable(ctx, opts.network(), opts.Aliases); err != nil {
+		return nil, err
+	}
+	netOpts := nettypes.PerNetworkOptions{Aliases: opts.Aliases}
+	spec.Networks = map[string]nettypes.PerNetworkOptions{opts.network(): netOpts}
+	report, err := networkInspect(ctx, opts.network(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error inspecting network %s: %v", opts.network(), err)
+	}
+	if len(report.Subnets) == 0 && opts.StaticIP == nil {
+		return func() {}, nil
+	}
+	ip, err := AllocateIP(ctx, opts.network(), containerName, opts.StaticIP)
+	if err != nil {
+		return nil, err
+	}
+	netOpts.StaticIPs = []net.IP{ip}
+	spec.Networks[opts.network()] = netOpts
+	return func() {
+		if err := ReleaseIP(opts.network(), containerName); err != nil {
+			log.Printf("Error releasing IP of %s: %v", containerName, err)
+		}
+	}, nil
+}
+
+// createContainer applies the networking options to spec and creates the
+// container, undoing the reservations if podman refuses it.
+func createContainer(ctx context.Context, spec *specgen.SpecGenerator, opts CreateOptions) (string, error) {
+	portMappings, releasePorts, err := reservePorts(ctx, opts.Ports)
+	if err != nil {
+		return "", err
+	}
+	defer releasePorts()
+	spec.PortMappings = portMappings
+	if err := checkShapeable(ctx, []string{opts.network()}, opts.Bandwidth); err != nil {
+		return "", err
+	}
+	release, err := pinNetwork(ctx, spec, spec.Name, opts)
+	if err != nil {
+		return "", err
+	}
+	// applied by StartPodmanContainer once the veth exists
+	if err := storeBandwidthLimits(spec.Name, opts.Bandwidth); err != nil {
+		release()
+		return "", err
+	}
+	ctrData, err := containersCreate(ctx, spec, nil)
+	if err != nil {
+		release()
+		if err := storeBandwidthLimits(spec.Name, BandwidthLimits{}); err != nil {
+			log.Printf("Error removing bandwidth limits of %s: %v", spec.Name, err)
+		}
+		return "", err
+	}
+	return ctrData.ID, nil
+}
+
+func CreateFromImage(ctx context.Context, imageName string, containerName string, opts CreateOptions) (string, error) {
+	CPUs, MemLimit := opts.CPUs, opts.MemLimit
 	if CPUs < 0 {
 		return "", fmt.Errorf("CPUs must be greater than 0")
 	}
 	if MemLimit < 0 {
 		return "", fmt.Errorf("Memory limit must be greater than 0")
 	}
+	if err := CheckImageTrust(ctx, imageName); err != nil {
+		return "", err
+	}
 	spec := new(specgen.SpecGenerator)
 	spec.Name = containerName
 	spec.Image = imageName
-	if static_ip != nil {
-		spec.Networks = map[string]nettypes.PerNetworkOptions{
-			"podman": {
-				StaticIPs: []net.IP{static_ip},
-			},
-		}
-	}
 	// get node hostname
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -435,7 +587,7 @@ func CreateFromImage(ctx context.Context, imageName string, containerName string
 	baseDir := "/var/log/"
 	jobLogDir := filepath.Join(baseDir, hostname, containerName)
 	if err := os.MkdirAll(jobLogDir, 0755); err != nil {
-		log.Fatalf("failed to create log dir: %v", err)
+		return "", fmt.Errorf("failed to create log dir: %w", err)
 	}
 
 	spec.Mounts = []specs.Mount{
@@ -462,12 +614,7 @@ func CreateFromImage(ctx context.Context, imageName string, containerName string
 		spec.ResourceLimits.Memory.Limit = utils.GetPtr(MemLimit)
 	}
 
-	ctrData, err := containersCreate(ctx, spec, nil)
-	if err != nil {
-		return "", err
-	}
-
-	return ctrData.ID, nil
+	return createContainer(ctx, spec, opts)
 }
 
 func RemovePodmanContainer(ctx context.Context, containerID string) error {
@@ -493,7 +640,23 @@ func RemovePodmanContainer(ctx context.Context, containerID string) error {
 			return report.Err
 		}
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	// a new container with the same name starts without a policy, limits or units
+	if err := netpolicy.Delete(inspectData.Name); err != nil {
+		log.Printf("Error removing network policy of %s: %v", inspectData.Name, err)
+	}
+	if err := storeBandwidthLimits(inspectData.Name, BandwidthLimits{}); err != nil {
+		log.Printf("Error removing bandwidth limits of %s: %v", inspectData.Name, err)
+	}
+	if err := storeDesiredEBPFUnits(inspectData.Name, nil); err != nil {
+		log.Printf("Error removing eBPF units of %s: %v", inspectData.Name, err)
+	}
+	if err := removeCollectedOutput(inspectData.Name); err != nil {
+		log.Printf("Error removing collected output of %s: %v", inspectData.Name, err)
+	}
+	return nil
 }
 
 func GetContainerName(ctx context.Context, containerID string) (string, error) {
@@ -513,11 +676,97 @@ func GetIPAddress(ctx context.Context, containerID string) (string, error) {
 	if inspectData.NetworkSettings == nil {
 		return "", fmt.Errorf("No network settings found for container")
 	}
-	return inspectData.NetworkSettings.IPAddress, nil
+	return ipFromInspect(inspectData), nil
+}
+
+// ipFromInspect prefers the address on the default network.
+func ipFromInspect(inspectData *define.InspectContainerData) string {
+	if inspectData.NetworkSettings == nil {
+		return ""
+	}
+	if inspectData.NetworkSettings.IPAddress != "" {
+		return inspectData.NetworkSettings.IPAddress
+	}
+	// containers on a non-default network only report per-network addresses
+	if ns, ok := inspectData.NetworkSettings.Networks[DefaultNetwork]; ok && ns.IPAddress != "" {
+		return ns.IPAddress
+	}
+	for _, ns := range inspectData.NetworkSettings.Networks {
+		if ns.IPAddress != "" {
+			return ns.IPAddress
+		}
+	}
+	return ""
 }
 
-func CreateEBPFContainer(ctx context.Context, imageName string, containerName string, static_ip net.IP, CPUs float64, MemLimit int64) (string, error) {
-	image := "base_ebpf:latest"
+// PodmanContainerDetails describes a single environment.
+type PodmanContainerDetails struct {
+	ID           string          `json:"env_id"`
+	Name         string          `json:"name"`
+	Image        string          `json:"image"`
+	State        string          `json:"state"`
+	IP           string          `json:"ip"`
+	DNSNames     []string        `json:"dns_names"`
+	Networks     []string        `json:"networks"`
+	PortMappings []PortMapping   `json:"port_mappings"`
+	Bandwidth    BandwidthStatus `json:"bandwidth"`
+}
+
+func InspectPodmanContainer(ctx context.Context, containerID string) (PodmanContainerDetails, error) {
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return PodmanContainerDetails{}, err
+	}
+	details := PodmanContainerDetails{
+		ID:           inspectData.ID,
+		Name:         inspectData.Name,
+		Image:        inspectData.ImageName,
+		State:        inspectData.State.Status,
+		Networks:     []string{},
+		PortMappings: []PortMapping{},
+	}
+	if ns := inspectData.NetworkSettings; ns != nil {
+		for name := range ns.Networks {
+			details.Networks = append(details.Networks, name)
+		}
+		sort.Strings(details.Networks)
+		// keys look like "80/tcp"
+		for key, bindings := range ns.Ports {
+			port, proto, _ := strings.Cut(key, "/")
+			ctrPort, err := strconv.ParseUint(port, 10, 16)
+			if err != nil {
+				continue
+			}
+			for _, b := range bindings {
+				hostPort, err := strconv.ParseUint(b.HostPort, 10, 16)
+				if err != nil {
+					continue
+				}
+				details.PortMappings = append(details.PortMappings, PortMapping{
+					HostIP:        b.HostIP,
+					HostPort:      uint16(hostPort),
+					ContainerPort: uint16(ctrPort),
+					Protocol:      proto,
+				})
+			}
+		}
+	}
+	details.IP = ipFromInspect(inspectData)
+	dnsNetworks, err := dnsEnabledNetworks(ctx)
+	if err != nil {
+		return details, err
+	}
+	details.DNSNames = containerDNSNames(inspectData, dnsNetworks)
+	details.Bandwidth, err = GetBandwidthStatus(ctx, containerID)
+	if err != nil {
+		return details, err
+	}
+	return details, nil
+}
+
+func CreateEBPFContainer(ctx context.Context, imageName string, containerName string, opts CreateOptions) (string, error) {
+	CPUs, MemLimit := opts.CPUs, opts.MemLimit
+	image := defaultEBPFImage
 	if len(imageName) > 1 && imageName != "" {
 		image = imageName
 	}
@@ -527,13 +776,14 @@ func CreateEBPFContainer(ctx context.Context, imageName string, containerName st
 	if MemLimit < 0 {
 		return "", fmt.Errorf("Memory limit must be greater than 0")
 	}
-	// Get kernel version
-	kernelVer, err := exec.Command("uname", "-r").Output()
-	if err != nil {
-		log.Fatalf("failed to get kernel version: %v", err)
+	if err := CheckImageTrust(ctx, image); err != nil {
+		return "", err
+	}
+	preflight := CheckEBPFPreflight(ctx, image, opts.MountProfile)
+	if err := preflight.Err(); err != nil {
+		return "", err
 	}
-	// Remove trailing newline character
-	kernel := string(kernelVer[:len(kernelVer)-1])
+	kernel := preflight.Kernel
 
 	jobID := ""
 	if len(containerName) > 1 && containerName != "" {
@@ -542,7 +792,7 @@ func CreateEBPFContainer(ctx context.Context, imageName string, containerName st
 		// Generate 12 character random hex string for job ID
 		bytes := make([]byte, 12)
 		if _, err := rand.Read(bytes); err != nil {
-			log.Fatalf("failed to generate job ID: %v", err)
+			return "", fmt.Errorf("failed to generate job ID: %w", err)
 		}
 		jobID = hex.EncodeToString(bytes)
 	}
@@ -557,19 +807,12 @@ func CreateEBPFContainer(ctx context.Context, imageName string, containerName st
 	baseDir := "/var/log/"
 	jobLogDir := filepath.Join(baseDir, hostname, jobID)
 	if err := os.MkdirAll(jobLogDir, 0755); err != nil {
-		log.Fatalf("failed to create log dir: %v", err)
+		return "", fmt.Errorf("failed to create log dir: %w", err)
 	}
 
 	spec := new(specgen.SpecGenerator)
 	spec.Name = jobID
 	spec.Image = image
-	if static_ip != nil {
-		spec.Networks = map[string]nettypes.PerNetworkOptions{
-			"podman": {
-				StaticIPs: []net.IP{static_ip},
-			},
-		}
-	}
 
 	spec.ResourceLimits = new(specs.LinuxResources)
 
@@ -586,57 +829,20 @@ func CreateEBPFContainer(ctx context.Context, imageName string, containerName st
 		spec.ResourceLimits.Memory.Limit = utils.GetPtr(MemLimit)
 	}
 
-	spec.Privileged = utils.GetPtr(true)
-
-	spec.Mounts = []specs.Mount{
-		{
-			Source:      fmt.Sprintf("/usr/src/kernels/%s", kernel),
-			Destination: fmt.Sprintf("/usr/src/kernels/%s", kernel),
-			Type:        "bind",
-			Options:     []string{"ro"},
-		},
-		{
-			Source:      fmt.Sprintf("/lib/modules/%s", kernel),
-			Destination: fmt.Sprintf("/lib/modules/%s", kernel),
-			Type:        "bind",
-			Options:     []string{"ro"},
-		},
-		{
-			Source:      jobLogDir,
-			Destination: "/var/log/",
-			Type:        "bind",
-			Options:     []string{"rw"},
-		},
-		{
-			Source:      "/sys/fs/cgroup",
-			Destination: "/sys/fs/cgroup",
-			Type:        "bind",
-			Options:     []string{"ro"},
-		},
-		{
-			Type:        "tmpfs",
-			Source:      "tmpfs",
-			Destination: "/run",
-			Options:     []string{"rw", "nosuid", "nodev", "noexec"},
-		},
-		{
-			Type:        "tmpfs",
-			Source:      "tmpfs",
-			Destination: "/run/lock",
-			Options:     []string{"rw", "nosuid", "nodev", "noexec"},
-		},
-	}
-	// spec.PortMappings = []nettypes.PortMapping{
-	// 	{HostPort: 5801, ContainerPort: 5801},
-	// 	{HostPort: 7681, ContainerPort: 7681},
-	// }
-	spec.CapAdd = []string{"CAP_BPF", "CAP_SYS_ADMIN"}
-	spec.Terminal = utils.GetPtr(false)
-
-	ctrData, err := containersCreate(ctx, spec, nil)
+	mounts, err := profileMounts(opts.MountProfile, kernel)
 	if err != nil {
 		return "", err
 	}
+	spec.Mounts = append(mounts, specs.Mount{
+		Source:      jobLogDir,
+		Destination: "/var/log/",
+		Type:        "bind",
+		Options:     []string{"rw"},
+	})
+	if err := applyEBPFPrivileges(spec, opts); err != nil {
+		return "", err
+	}
+	spec.Terminal = utils.GetPtr(false)
 
-	return ctrData.ID, nil
+	return createContainer(ctx, spec, opts)
 }
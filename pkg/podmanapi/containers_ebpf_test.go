@@ -0,0 +1,311 @@
+package podmanapi
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
+	"github.com/sonarping/go-nodeapi/pkg/systemd"
+)
+
+type fakeSystemd struct {
+	mu      sync.Mutex
+	units   []systemd.UnitStatus
+	pattern string
+	calls   []string
+	closed  bool
+}
+
+func (f *fakeSystemd) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeSystemd) ListUnits(pattern string) ([]systemd.UnitStatus, error) {
+	f.pattern = pattern
+	return f.units, nil
+}
+
+func (f *fakeSystemd) UnitStatus(name string) (systemd.UnitStatus, error) {
+	for _, u := range f.units {
+		if u.Name == name {
+			return u, nil
+		}
+	}
+	return systemd.UnitStatus{Name: name, LoadState: "loaded", ActiveState: "inactive", SubState: "dead"}, nil
+}
+
+func (f *fakeSystemd) Reload() error {
+	f.record("reload")
+	return nil
+}
+
+func (f *fakeSystemd) EnableUnit(name string) error {
+	f.record("enable " + name)
+	return nil
+}
+
+func (f *fakeSystemd) DisableUnit(name string) error {
+	f.record("disable " + name)
+	return nil
+}
+
+func (f *fakeSystemd) StartUnit(name string, timeout time.Duration) (systemd.UnitStatus, error) {
+	f.record("start " + name)
+	return systemd.UnitStatus{Name: name, LoadState: "loaded", ActiveState: "active", SubState: "running"}, nil
+}
+
+func (f *fakeSystemd) StopUnit(name string, timeout time.Duration) (systemd.UnitStatus, error) {
+	f.record("stop " + name)
+	return systemd.UnitStatus{Name: name, LoadState: "loaded", ActiveState: "inactive", SubState: "dead"}, nil
+}
+
+func (f *fakeSystemd) RestartUnit(name string, timeout time.Duration) (systemd.UnitStatus, error) {
+	f.record("restart " + name)
+	return systemd.UnitStatus{Name: name, LoadState: "loaded", ActiveState: "active", SubState: "running"}, nil
+}
+
+func (f *fakeSystemd) Close() error {
+	f.closed = true
+	return nil
+}
+
+// withFakeSystemd makes the container with pid 4242 run and answer D-Bus
+// calls with fake.
+func withFakeSystemd(t *testing.T, fake *fakeSystemd) {
+	t.Helper()
+	origInspect := containersInspect
+	origDial := dialContainerSystemd
+	t.Cleanup(func() {
+		containersInspect = origInspect
+		dialContainerSystemd = origDial
+	})
+	containersInspect = func(ctx context.Context, nameOrID string, options *containers.InspectOptions) (*define.InspectContainerData, error) {
+		return &define.InspectContainerData{
+			ID:    nameOrID,
+			Name:  "env1",
+			State: &define.InspectContainerState{Status: define.ContainerStateRunning.String(), Pid: 4242},
+		}, nil
+	}
+	dialContainerSystemd = func(pid int) (containerSystemd, error) {
+		if pid != 4242 {
+			t.Errorf("expected container pid 4242, got: %d", pid)
+		}
+		return fake, nil
+	}
+}
+
+func TestGetEBPFSystemdUnits(t *testing.T) {
+	since := time.Unix(1700000000, 0)
+	fake := &fakeSystemd{units: []systemd.UnitStatus{
+		{Name: "ebpf_trace.service", Description: "Trace execs", LoadState: "loaded", ActiveState: "active", SubState: "running", Since: since, MainPID: 42},
+		{Name: "ebpf_idle.service", LoadState: "loaded", ActiveState: "inactive", SubState: "dead"},
+	}}
+	withFakeSystemd(t, fake)
+
+	units, err := GetEBPFSystemdUnits(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if fake.pattern != "ebpf_*" || !fake.closed {
+		t.Errorf("expected ebpf_* units to be listed and the connection closed, got pattern %q", fake.pattern)
+	}
+	if len(units) != 2 || !units[0].Active || units[0].Since != since.Unix() || units[0].MainPID != 42 || units[0].SubState != "running" {
+		t.Errorf("unexpected first unit: %#v", units)
+	}
+	if units[1].Active || units[1].Since != 0 {
+		t.Errorf("unexpected second unit: %#v", units[1])
+	}
+}
+
+func TestDeployEBPFProgram(t *testing.T) {
+	fake := &fakeSystemd{}
+	withFakeSystemd(t, fake)
+	origCopy := containersCopyFromArchive
+	origExec := containerExecFunc
+	defer func() {
+		containersCopyFromArchive = origCopy
+		containerExecFunc = origExec
+	}()
+
+	files := map[string]string{}
+	containersCopyFromArchive = func(ctx context.Context, nameOrID string, path string, reader io.Reader) (types.ContainerCopyFunc, error) {
+		if path != "/" {
+			t.Errorf("expected archive to be extracted at /, got: %s", path)
+		}
+		tr := tar.NewReader(reader)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(tr)
+			files[hdr.Name] = string(data)
+		}
+		return func() error { return nil }, nil
+	}
+	var execCmd []string
+	containerExecFunc = func(ctx context.Context, containerID string, command []string) (string, error) {
+		execCmd = command
+		return "", nil
+	}
+
+	status, err := DeployEBPFProgram(context.Background(), "abc", EBPFDeployRequest{
+		Name:         "ebpf_trace",
+		ProgramName:  "trace.bpf.c",
+		Program:      []byte("int x;"),
+		BuildCommand: "make",
+		ExecStart:    "/opt/ebpf/ebpf_trace/trace",
+		Enable:       true,
+		Start:        true,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !status.Active || status.Name != "ebpf_trace.service" {
+		t.Errorf("unexpected status: %#v", status)
+	}
+	if files["opt/ebpf/ebpf_trace/trace.bpf.c"] != "int x;" {
+		t.Errorf("program not copied: %v", files)
+	}
+	if unit := files["etc/systemd/system/ebpf_trace.service"]; !strings.Contains(unit, "ExecStart=/opt/ebpf/ebpf_trace/trace") {
+		t.Errorf("unexpected unit file: %q", unit)
+	}
+	if len(execCmd) != 3 || execCmd[2] != "cd /opt/ebpf/ebpf_trace && make" {
+		t.Errorf("unexpected build command: %v", execCmd)
+	}
+	if strings.Join(fake.calls, ",") != "reload,enable ebpf_trace.service,start ebpf_trace.service" {
+		t.Errorf("unexpected systemd calls: %v", fake.calls)
+	}
+}
+
+func TestValidateEBPFDeployRequest(t *testing.T) {
+	base := EBPFDeployRequest{Name: "ebpf_trace", ProgramName: "trace.o", Program: []byte{1}, ExecStart: "/bin/true"}
+	if err := ValidateEBPFDeployRequest(base); err != nil {
+		t.Fatalf("expected valid request, got: %v", err)
+	}
+	invalid := []func(r *EBPFDeployRequest){
+		func(r *EBPFDeployRequest) { r.Name = "trace" },
+		func(r *EBPFDeployRequest) { r.Name = "ebpf_../x" },
+		func(r *EBPFDeployRequest) { r.ProgramName = "../trace.o" },
+		func(r *EBPFDeployRequest) { r.ExecStart = "" },
+		func(r *EBPFDeployRequest) { r.Program = nil },
+		func(r *EBPFDeployRequest) { r.Name = "ebpf_trace\nExecStartPre=/bin/sh -c id" },
+		func(r *EBPFDeployRequest) { r.ExecStart = "/bin/true\nExecStartPre=/bin/sh -c id" },
+		func(r *EBPFDeployRequest) { r.ExecStart = "/bin/true\rUser=root" },
+	}
+	for i, mutate := range invalid {
+		r := base
+		mutate(&r)
+		if err := ValidateEBPFDeployRequest(r); err == nil {
+			t.Errorf("case %d: expected %#v to be rejected", i, r)
+		}
+	}
+}
+
+func TestRunEBPFBatch(t *testing.T) {
+	origList := containersList
+	origDial := dialContainerSystemd
+	defer func() {
+		containersList = origList
+		dialContainerSystemd = origDial
+	}()
+
+	containersList = func(ctx context.Context, options *containers.ListOptions) ([]types.ListContainer, error) {
+		if label := options.Filters["label"]; len(label) != 1 || label[0] != "scenario=monitoring" {
+			t.Errorf("expected label filter, got: %v", options.Filters)
+		}
+		return []types.ListContainer{
+			{ID: "a", Names: []string{"env1"}, Pid: 1},
+			{ID: "b", Names: []string{"env2"}, Pid: 2},
+		}, nil
+	}
+	fake := &fakeSystemd{}
+	dialContainerSystemd = func(pid int) (containerSystemd, error) {
+		if pid == 2 {
+			return nil, fmt.Errorf("no systemd in container")
+		}
+		return fake, nil
+	}
+
+	results, err := RunEBPFBatch(context.Background(), EBPFBatchRequest{
+		Action: "restart",
+		Units:  []string{"ebpf_trace", "ebpf_net.service"},
+		Label:  "scenario=monitoring",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected a result per unit and container, got: %#v", results)
+	}
+	if !results[0].OK || results[0].Container != "env1" || results[0].Unit != "ebpf_trace.service" || results[0].Status.ActiveState != "active" {
+		t.Errorf("unexpected first result: %#v", results[0])
+	}
+	if results[2].OK || results[2].Container != "env2" || results[2].Error != "no systemd in container" {
+		t.Errorf("expected dial failure on env2, got: %#v", results[2])
+	}
+	if strings.Join(fake.calls, ",") != "restart ebpf_trace.service,restart ebpf_net.service" {
+		t.Errorf("unexpected systemd calls: %v", fake.calls)
+	}
+
+	for _, req := range []EBPFBatchRequest{
+		{Action: "reload", Units: []string{"ebpf_a"}, Label: "x"},
+		{Action: "start", Label: "x"},
+		{Action: "start", Units: []string{"sshd"}, Label: "x"},
+		{Action: "start", Units: []string{"ebpf_a"}},
+	} {
+		if err := ValidateEBPFBatchRequest(req); err == nil {
+			t.Errorf("expected %#v to be rejected", req)
+		}
+	}
+}
+
+func TestDesiredEBPFUnits(t *testing.T) {
+	fake := &fakeSystemd{}
+	withFakeSystemd(t, fake)
+	origPath := ebpfUnitsStatePath
+	defer func() { ebpfUnitsStatePath = origPath }()
+	ebpfUnitsStatePath = filepath.Join(t.TempDir(), "ebpf_units.json")
+
+	if _, err := SetDesiredEBPFUnits(context.Background(), "abc", []string{"sshd"}); err == nil {
+		t.Errorf("expected non ebpf_ units to be rejected")
+	}
+	results, err := SetDesiredEBPFUnits(context.Background(), "abc", []string{"ebpf_trace", "ebpf_net", "ebpf_trace.service"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(results) != 2 || !results[0].OK || results[0].Unit != "ebpf_net.service" {
+		t.Errorf("expected both units to be started, got: %#v", results)
+	}
+	units, err := GetDesiredEBPFUnits(context.Background(), "abc")
+	if err != nil || strings.Join(units, ",") != "ebpf_net.service,ebpf_trace.service" {
+		t.Errorf("unexpected stored units: %v, %v", units, err)
+	}
+
+	fake.calls = nil
+	if _, err := ApplyDesiredEBPFUnits(context.Background(), "abc"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if strings.Join(fake.calls, ",") != "start ebpf_net.service,start ebpf_trace.service" {
+		t.Errorf("unexpected systemd calls: %v", fake.calls)
+	}
+
+	status, err := EnableEBPFService(context.Background(), "abc", "ebpf_trace")
+	if err != nil || status.Name != "ebpf_trace.service" {
+		t.Errorf("unexpected enable result: %#v, %v", status, err)
+	}
+	if fake.calls[len(fake.calls)-1] != "enable ebpf_trace.service" {
+		t.Errorf("expected unit to be enabled, got: %v", fake.calls)
+	}
+}
@@ -3,28 +3,66 @@ package podmanapi
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/containers/podman/v5/libpod/define"
 	"github.com/containers/podman/v5/pkg/bindings/containers"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+	"github.com/sonarping/go-nodeapi/pkg/netpolicy"
 )
 
 // saveOriginals helps to restore original function variables after each test.
-func saveOriginals() func() {
+// Everything StartPodmanContainer reapplies after a start works on state
+// below t.TempDir() and never reaches the host.
+func saveOriginals(t *testing.T) func() {
 	origInspect := containersInspect
+	origList := containersList
 	origStart := containersStart
 	origWait := containersWait
+	origApply := applyNetworkPolicies
+	origTC := runTCFunc
+	origReapply := reapplyEBPFUnits
+	origProc := procRoot
+	origIPAM, origBandwidth, origCollector := ipamStatePath, bandwidthStatePath, collectorStatePath
+	origUnits, origOutput := ebpfUnitsStatePath, ebpfOutputDir
+
+	dir := t.TempDir()
+	restorePolicies := netpolicy.SetStatePath(filepath.Join(dir, "netpolicy.json"))
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return nil, nil
+	}
+	applyNetworkPolicies = func([]netpolicy.Endpoint) error { return nil }
+	runTCFunc = func(args ...string) ([]byte, error) {
+		t.Errorf("unexpected tc call: %v", args)
+		return nil, nil
+	}
+	reapplyEBPFUnits = func(ctx context.Context, containerID string, name string) {}
+	procRoot = filepath.Join(dir, "proc")
+	ipamStatePath = filepath.Join(dir, "ipam.json")
+	bandwidthStatePath = filepath.Join(dir, "bandwidth.json")
+	collectorStatePath = filepath.Join(dir, "collectors.json")
+	ebpfUnitsStatePath = filepath.Join(dir, "ebpf_units.json")
+	ebpfOutputDir = filepath.Join(dir, "output")
 
 	return func() {
 		containersInspect = origInspect
+		containersList = origList
 		containersStart = origStart
 		containersWait = origWait
+		applyNetworkPolicies = origApply
+		runTCFunc = origTC
+		reapplyEBPFUnits = origReapply
+		procRoot = origProc
+		ipamStatePath, bandwidthStatePath, collectorStatePath = origIPAM, origBandwidth, origCollector
+		ebpfUnitsStatePath, ebpfOutputDir = origUnits, origOutput
+		restorePolicies()
 	}
 }
 
 func TestStartPodmanContainer_AlreadyRunning(t *testing.T) {
-	restore := saveOriginals()
+	restore := saveOriginals(t)
 	defer restore()
 
 	// Simulate container already running.
@@ -45,7 +83,7 @@ func TestStartPodmanContainer_AlreadyRunning(t *testing.T) {
 }
 
 func TestStartPodmanContainer_Success(t *testing.T) {
-	restore := saveOriginals()
+	restore := saveOriginals(t)
 	defer restore()
 
 	callCount := 0
@@ -97,7 +135,7 @@ func TestStartPodmanContainer_Success(t *testing.T) {
 }
 
 func TestStartPodmanContainer_WaitTimeout(t *testing.T) {
-	restore := saveOriginals()
+	restore := saveOriginals(t)
 	defer restore()
 
 	// Inspect: first call returns not running.
@@ -0,0 +1,144 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/containers/podman/v5/libpod/define"
+)
+
+// aliases end up as names in aardvark-dns, so they must be valid hostnames
+var dnsNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// ErrDNSDisabled is returned for aliases on networks without DNS, nothing
+// would resolve them there.
+var ErrDNSDisabled = errors.New("network has DNS disabled")
+
+// DNSRecord is a name containers on Network resolve to IPs.
+type DNSRecord struct {
+	Network   string   `json:"network"`
+	Name      string   `json:"name"`
+	IPs       []string `json:"ips"`
+	ID        string   `json:"env_id"`
+	Container string   `json:"container"`
+}
+
+func ValidateAliases(aliases []string) error {
+	for _, alias := range aliases {
+		if len(alias) > 253 || !dnsNameRegexp.MatchString(alias) {
+			return fmt.Errorf("invalid DNS alias %q", alias)
+		}
+	}
+	return nil
+}
+
+// checkAliasesResolvable rejects aliases on networks aardvark-dns does not
+// serve, like the default podman network.
+func checkAliasesResolvable(ctx context.Context, networkName string, aliases []string) error {
+	if len(aliases) == 0 {
+		return nil
+	}
+	report, err := networkInspect(ctx, networkName, nil)
+	if err != nil {
+		return fmt.Errorf("error inspecting network %s: %v", networkName, err)
+	}
+	if !report.DNSEnabled {
+		return fmt.Errorf("%w: aliases on %s would not resolve, use a network with dns_enabled", ErrDNSDisabled, networkName)
+	}
+	return nil
+}
+
+// dnsNames merges the container name with its aliases on one network.
+func dnsNames(name string, aliases []string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, n := range append([]string{name}, aliases...) {
+		if n != "" && !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// attachedDNSNames looks up the aliases a container has on networkName.
+func attachedDNSNames(ctx context.Context, containerID string, name string, networkName string) []string {
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil || inspectData.NetworkSettings == nil {
+		return dnsNames(name, nil)
+	}
+	ns, ok := inspectData.NetworkSettings.Networks[networkName]
+	if !ok {
+		return dnsNames(name, nil)
+	}
+	return dnsNames(name, ns.Aliases)
+}
+
+// dnsEnabledNetworks returns the names of the networks served by aardvark-dns.
+func dnsEnabledNetworks(ctx context.Context) (map[string]bool, error) {
+	networks, err := networkList(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error listing networks: %v", err)
+	}
+	enabled := map[string]bool{}
+	for _, n := range networks {
+		if n.DNSEnabled {
+			enabled[n.Name] = true
+		}
+	}
+	return enabled, nil
+}
+
+// containerDNSNames returns the names a container is resolvable by on any
+// of its DNS enabled networks.
+func containerDNSNames(inspectData *define.InspectContainerData, dnsNetworks map[string]bool) []string {
+	names := []string{}
+	if inspectData.NetworkSettings == nil {
+		return names
+	}
+	seen := map[string]bool{}
+	for netName, ns := range inspectData.NetworkSettings.Networks {
+		if !dnsNetworks[netName] {
+			continue
+		}
+		for _, n := range dnsNames(inspectData.Name, ns.Aliases) {
+			if !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetDNSRecords lists every name resolvable on the DNS enabled networks of
+// this node.
+func GetDNSRecords(ctx context.Context) ([]DNSRecord, error) {
+	dnsNetworks, err := dnsEnabledNetworks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	records := []DNSRecord{}
+	for _, netName := range sortedKeys(dnsNetworks) {
+		details, err := InspectNetwork(ctx, netName)
+		if err != nil {
+			return nil, err
+		}
+		for _, attachment := range details.Containers {
+			for _, name := range attachment.DNSNames {
+				records = append(records, DNSRecord{
+					Network:   netName,
+					Name:      name,
+					IPs:       attachment.IPs,
+					ID:        attachment.ID,
+					Container: attachment.Name,
+				})
+			}
+		}
+	}
+	return records, nil
+}
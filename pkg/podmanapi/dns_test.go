@@ -0,0 +1,99 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/bindings/network"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+)
+
+func TestGetDNSRecords(t *testing.T) {
+	origList := networkList
+	origInspect := networkInspect
+	origCtrInspect := containersInspect
+	defer func() {
+		networkList = origList
+		networkInspect = origInspect
+		containersInspect = origCtrInspect
+	}()
+
+	networkList = func(ctx context.Context, _ *network.ListOptions) ([]types.Network, error) {
+		return []types.Network{{Name: "podman"}, {Name: "labnet", DNSEnabled: true}}, nil
+	}
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		if nameOrID != "labnet" {
+			t.Errorf("expected only DNS enabled networks to be inspected, got: %s", nameOrID)
+		}
+		report := entitiesTypes.NetworkInspectReport{}
+		report.Name = nameOrID
+		report.DNSEnabled = true
+		report.Containers = map[string]entitiesTypes.NetworkContainerInfo{
+			"abc": {
+				Name: "env1",
+				Interfaces: map[string]types.NetInterface{
+					"eth0": {Subnets: []types.NetAddress{{IPNet: types.IPNet{IPNet: net.IPNet{IP: net.ParseIP("10.90.0.2")}}}}},
+				},
+			},
+		}
+		return report, nil
+	}
+	containersInspect = func(ctx context.Context, nameOrID string, _ *containers.InspectOptions) (*define.InspectContainerData, error) {
+		return &define.InspectContainerData{
+			Name: "env1",
+			NetworkSettings: &define.InspectNetworkSettings{
+				Networks: map[string]*define.InspectAdditionalNetwork{
+					"labnet": {Aliases: []string{"env1", "db"}},
+				},
+			},
+		}, nil
+	}
+
+	records, err := GetDNSRecords(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(records) != 2 || records[0].Name != "env1" || records[1].Name != "db" {
+		t.Fatalf("expected env1 and db records, got: %#v", records)
+	}
+	if records[1].Network != "labnet" || records[1].IPs[0] != "10.90.0.2" || records[1].Container != "env1" {
+		t.Errorf("unexpected record: %#v", records[1])
+	}
+}
+
+func TestValidateAliases(t *testing.T) {
+	if err := ValidateAliases([]string{"db", "db.lab.internal"}); err != nil {
+		t.Errorf("expected valid aliases, got: %v", err)
+	}
+	for _, alias := range []string{"", "-db", "db_1", "a b"} {
+		if err := ValidateAliases([]string{alias}); err == nil {
+			t.Errorf("expected %q to be rejected", alias)
+		}
+	}
+}
+
+func TestListPodmanContainers_WithoutNetworks(t *testing.T) {
+	origList, origNetList, origInspect := containersList, networkList, containersInspect
+	defer func() {
+		containersList, networkList, containersInspect = origList, origNetList, origInspect
+	}()
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return []entitiesTypes.ListContainer{{ID: "abc", Names: []string{"env1"}, State: "exited"}}, nil
+	}
+	networkList = func(ctx context.Context, _ *network.ListOptions) ([]types.Network, error) {
+		return nil, errors.New("netavark failed")
+	}
+	containersInspect = func(ctx context.Context, nameOrID string, _ *containers.InspectOptions) (*define.InspectContainerData, error) {
+		return &define.InspectContainerData{Name: "env1"}, nil
+	}
+
+	list, err := ListPodmanContainers(context.Background())
+	if err != nil || len(list) != 1 {
+		t.Errorf("expected containers to be listed without DNS names, got: %#v, %v", list, err)
+	}
+}
@@ -0,0 +1,383 @@
+package podmanapi
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/sonarping/go-nodeapi/pkg/systemd"
+)
+
+const (
+	// deployed programs live in ebpfProgramDir/<unit name>/ inside the container
+	ebpfProgramDir = "/opt/ebpf"
+	ebpfUnitDir    = "/etc/systemd/system"
+	unitJobTimeout = 30 * time.Second
+)
+
+// Dependency injection variables for testing:
+var (
+	containersCopyFromArchive = containers.CopyFromArchive
+	containerExecFunc         = ContainerExec
+)
+
+// unit names follow the ebpf_<name> convention the API uses to find them
+var ebpfUnitRegexp = regexp.MustCompile(`^ebpf_[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// EBPFDeployRequest describes a program and the unit that runs it.
+type EBPFDeployRequest struct {
+	// unit name, ebpf_<name> with or without the .service suffix
+	Name string
+	// file name of the object file or source inside the program directory
+	ProgramName string
+	Program     []byte
+	// optional shell command run in the program directory, e.g. to compile source
+	BuildCommand string
+	// complete unit file; when empty a simple service running ExecStart is generated
+	Unit      string
+	ExecStart string
+	Enable    bool
+	Start     bool
+}
+
+// unitName returns the unit name with the .service suffix.
+func (r EBPFDeployRequest) unitName() string {
+	return strings.TrimSuffix(r.Name, ".service") + ".service"
+}
+
+func (r EBPFDeployRequest) programDir() string {
+	return path.Join(ebpfProgramDir, strings.TrimSuffix(r.Name, ".service"))
+}
+
+func ValidateEBPFDeployRequest(r EBPFDeployRequest) error {
+	// both end up in the generated unit, a line break would add directives
+	if strings.ContainsAny(r.Name, "\r\n") {
+		return fmt.Errorf("unit name must be a single line")
+	}
+	if strings.ContainsAny(r.ExecStart, "\r\n") {
+		return fmt.Errorf("exec_start must be a single line")
+	}
+	name := strings.TrimSuffix(r.Name, ".service")
+	if !ebpfUnitRegexp.MatchString(name) {
+		return fmt.Errorf("invalid unit name %q, expected ebpf_<name> using letters, digits, _ and -", r.Name)
+	}
+	if len(r.Program) == 0 {
+		return fmt.Errorf("program is required")
+	}
+	if r.ProgramName == "" || r.ProgramName != path.Base(r.ProgramName) || r.ProgramName == "." || r.ProgramName == ".." {
+		return fmt.Errorf("invalid program file name %q", r.ProgramName)
+	}
+	if r.Unit == "" && r.ExecStart == "" {
+		return fmt.Errorf("either a unit definition or exec_start is required")
+	}
+	if r.Unit != "" && !strings.Contains(r.Unit, "[Service]") {
+		return fmt.Errorf("unit definition has no [Service] section")
+	}
+	return nil
+}
+
+// unitFile returns the unit definition to install.
+func (r EBPFDeployRequest) unitFile() string {
+	if r.Unit != "" {
+		return r.Unit
+	}
+	return fmt.Sprintf(`[Unit]
+Description=eBPF program %s
+
+[Service]
+Type=simple
+WorkingDirectory=%s
+ExecStart=%s
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`, strings.TrimSuffix(r.Name, ".service"), r.programDir(), r.ExecStart)
+}
+
+// DeployEBPFProgram copies a program and its unit into a running container,
+// optionally builds the program, reloads systemd and enables/starts the unit.
+func DeployEBPFProgram(ctx context.Context, containerID string, req EBPFDeployRequest) (EBPFServiceStatus, error) {
+	if err := ValidateEBPFDeployRequest(req); err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	contData, err := containersInspect(ctx, containerID, &containers.InspectOptions{})
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	if contData.State.Status != define.ContainerStateRunning.String() {
+		return EBPFServiceStatus{}, fmt.Errorf("Container is not running")
+	}
+
+	archive, err := deployArchive(req)
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	copyFunc, err := containersCopyFromArchive(ctx, containerID, "/", archive)
+	if err != nil {
+		return EBPFServiceStatus{}, fmt.Errorf("error copying program into container: %v", err)
+	}
+	if err := copyFunc(); err != nil {
+		return EBPFServiceStatus{}, fmt.Errorf("error copying program into container: %v", err)
+	}
+
+	if req.BuildCommand != "" {
+		command := []string{"sh", "-c", fmt.Sprintf("cd %s && %s", req.programDir(), req.BuildCommand)}
+		if _, err := containerExecFunc(ctx, containerID, command); err != nil {
+			return EBPFServiceStatus{}, fmt.Errorf("error building program: %w", err)
+		}
+	}
+
+	conn, err := dialContainerSystemd(contData.State.Pid)
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	defer conn.Close()
+	if err := conn.Reload(); err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	if req.Enable {
+		if err := conn.EnableUnit(req.unitName()); err != nil {
+			return EBPFServiceStatus{}, err
+		}
+	}
+	if req.Start {
+		unit, err := conn.StartUnit(req.unitName(), unitJobTimeout)
+		if err != nil {
+			return EBPFServiceStatus{}, err
+		}
+		if unit.ActiveState != "active" {
+			return unitServiceStatus(unit), fmt.Errorf("service %s is %s after starting", unit.Name, unit.ActiveState)
+		}
+		return unitServiceStatus(unit), nil
+	}
+	unit, err := conn.UnitStatus(req.unitName())
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	return unitServiceStatus(unit), nil
+}
+
+// deployArchive packs the program and unit file as a tar to extract at /.
+func deployArchive(req EBPFDeployRequest) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	now := time.Now()
+	dirs := []string{ebpfProgramDir, req.programDir()}
+	for _, dir := range dirs {
+		hdr := &tar.Header{Name: strings.TrimPrefix(dir, "/") + "/", Mode: 0755, Typeflag: tar.TypeDir, ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+	}
+	files := []struct {
+		name string
+		mode int64
+		data []byte
+	}{
+		{path.Join(req.programDir(), req.ProgramName), 0755, req.Program},
+		{path.Join(ebpfUnitDir, req.unitName()), 0644, []byte(req.unitFile())},
+	}
+	for _, f := range files {
+		hdr := &tar.Header{Name: strings.TrimPrefix(f.name, "/"), Mode: f.mode, Size: int64(len(f.data)), Typeflag: tar.TypeReg, ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// batches run on at most this many containers at a time
+const maxBatchConcurrency = 8
+
+// EBPFBatchRequest runs one action on a set of units in several containers,
+// given by name or ID or selected by label.
+type EBPFBatchRequest struct {
+	// start, stop or restart
+	Action     string   `json:"action"`
+	Units      []string `json:"units"`
+	Containers []string `json:"containers"`
+	// key or key=value, selects all running containers with the label
+	Label string `json:"label"`
+}
+
+// EBPFBatchResult is the outcome of the action on one unit in one container.
+type EBPFBatchResult struct {
+	ID        string            `json:"env_id"`
+	Container string            `json:"container"`
+	Unit      string            `json:"unit"`
+	OK        bool              `json:"ok"`
+	Error     string            `json:"error,omitempty"`
+	Status    EBPFServiceStatus `json:"status"`
+}
+
+func ValidateEBPFBatchRequest(req EBPFBatchRequest) error {
+	switch req.Action {
+	case "start", "stop", "restart":
+	default:
+		return fmt.Errorf("invalid action %q, expected start, stop or restart", req.Action)
+	}
+	if len(req.Units) == 0 {
+		return fmt.Errorf("at least one unit is required")
+	}
+	for _, u := range req.Units {
+		if _, err := ebpfUnitName(u); err != nil {
+			return err
+		}
+	}
+	if (len(req.Containers) == 0) == (req.Label == "") {
+		return fmt.Errorf("either containers or a label is required")
+	}
+	return nil
+}
+
+type batchTarget struct {
+	id   string
+	name string
+	pid  int
+	err  error
+}
+
+// batchTargets resolves the containers of a batch request. Containers given
+// by name that cannot be used are returned with an error.
+func batchTargets(ctx context.Context, req EBPFBatchRequest) ([]batchTarget, error) {
+	targets := []batchTarget{}
+	if req.Label != "" {
+		ctrList, err := containersList(ctx, &containers.ListOptions{
+			Filters: map[string][]string{"label": {req.Label}, "status": {"running"}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing containers: %v", err)
+		}
+		for _, ctr := range ctrList {
+			name := ctr.ID
+			if len(ctr.Names) > 0 {
+				name = ctr.Names[0]
+			}
+			targets = append(targets, batchTarget{id: ctr.ID, name: name, pid: ctr.Pid})
+		}
+		return targets, nil
+	}
+	for _, c := range req.Containers {
+		target := batchTarget{id: c, name: c}
+		contData, err := containersInspect(ctx, c, &containers.InspectOptions{})
+		switch {
+		case err != nil:
+			target.err = err
+		case contData.State.Status != define.ContainerStateRunning.String():
+			target.id, target.name = contData.ID, contData.Name
+			target.err = fmt.Errorf("Container is not running")
+		default:
+			target.id, target.name, target.pid = contData.ID, contData.Name, contData.State.Pid
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// runUnitAction runs a start, stop or restart job and checks the unit ends
+// up in the expected state.
+func runUnitAction(conn containerSystemd, action string, unit string) (systemd.UnitStatus, error) {
+	var status systemd.UnitStatus
+	var err error
+	switch action {
+	case "start":
+		status, err = conn.StartUnit(unit, unitJobTimeout)
+	case "stop":
+		status, err = conn.StopUnit(unit, unitJobTimeout)
+	case "restart":
+		status, err = conn.RestartUnit(unit, unitJobTimeout)
+	}
+	if err != nil {
+		return status, err
+	}
+	if action == "stop" {
+		if status.ActiveState == "active" || status.ActiveState == "deactivating" {
+			return status, fmt.Errorf("service %s is %s after stopping", unit, status.ActiveState)
+		}
+	} else if status.ActiveState != "active" {
+		return status, fmt.Errorf("service %s is %s after %sing", unit, status.ActiveState, action)
+	}
+	return status, nil
+}
+
+// RunEBPFBatch runs the action on every unit of every target container,
+// working on several containers concurrently. Failures are reported per
+// unit in the results, in the order of the containers and units.
+func RunEBPFBatch(ctx context.Context, req EBPFBatchRequest) ([]EBPFBatchResult, error) {
+	if err := ValidateEBPFBatchRequest(req); err != nil {
+		return nil, err
+	}
+	targets, err := batchTargets(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	perTarget := make([][]EBPFBatchResult, len(targets))
+	sem := make(chan struct{}, maxBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target batchTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			perTarget[i] = runBatchTarget(target, req)
+		}(i, target)
+	}
+	wg.Wait()
+
+	results := []EBPFBatchResult{}
+	for _, r := range perTarget {
+		results = append(results, r...)
+	}
+	return results, nil
+}
+
+func runBatchTarget(target batchTarget, req EBPFBatchRequest) []EBPFBatchResult {
+	results := make([]EBPFBatchResult, 0, len(req.Units))
+	for _, u := range req.Units {
+		unit, _ := ebpfUnitName(u)
+		results = append(results, EBPFBatchResult{ID: target.id, Container: target.name, Unit: unit, Status: EBPFServiceStatus{Name: unit}})
+	}
+	fail := func(err error) []EBPFBatchResult {
+		for i := range results {
+			results[i].Error = err.Error()
+		}
+		return results
+	}
+	if target.err != nil {
+		return fail(target.err)
+	}
+	conn, err := dialContainerSystemd(target.pid)
+	if err != nil {
+		return fail(err)
+	}
+	defer conn.Close()
+	for i := range results {
+		status, err := runUnitAction(conn, req.Action, results[i].Unit)
+		if status.Name != "" {
+			results[i].Status = unitServiceStatus(status)
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].OK = true
+	}
+	return results
+}
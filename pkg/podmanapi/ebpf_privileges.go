@@ -0,0 +1,116 @@
+package podmanapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/common/pkg/seccomp"
+	"github.com/containers/podman/v5/pkg/specgen"
+	"github.com/sonarping/go-nodeapi/pkg/utils"
+)
+
+// the capabilities an unprivileged eBPF container may get: loading programs,
+// perf events and tracing, and attaching to network hooks
+var ebpfCapabilities = []string{"CAP_BPF", "CAP_PERFMON", "CAP_NET_ADMIN"}
+
+// Dependency injection variables for testing:
+var ebpfSeccompProfilePath = "/var/lib/abra/seccomp/ebpf.json"
+
+// ValidateEBPFCapabilities normalizes requested capabilities to CAP_ names
+// and checks they are allowed for unprivileged eBPF containers. No
+// capabilities select all of them.
+func ValidateEBPFCapabilities(caps []string) ([]string, error) {
+	if len(caps) == 0 {
+		return append([]string(nil), ebpfCapabilities...), nil
+	}
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, c := range caps {
+		name := strings.ToUpper(c)
+		if !strings.HasPrefix(name, "CAP_") {
+			name = "CAP_" + name
+		}
+		allowed := false
+		for _, a := range ebpfCapabilities {
+			allowed = allowed || a == name
+		}
+		if !allowed {
+			return nil, fmt.Errorf("capability %s is not allowed, expected any of %s or privileged mode", c, strings.Join(ebpfCapabilities, ", "))
+		}
+		if !seen[name] {
+			seen[name] = true
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized, nil
+}
+
+// writeEBPFSeccompProfile writes podman's default seccomp profile extended
+// to allow bpf() and perf_event_open() regardless of capabilities.
+func writeEBPFSeccompProfile() (string, error) {
+	profile := seccomp.DefaultProfile()
+	profile.Syscalls = append(profile.Syscalls, &seccomp.Syscall{
+		Names:   []string{"bpf", "perf_event_open"},
+		Action:  seccomp.ActAllow,
+		Args:    []*seccomp.Arg{},
+		Comment: "eBPF environments load programs and open perf events",
+	})
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(ebpfSeccompProfilePath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create seccomp profile dir: %w", err)
+	}
+	// replaced atomically, a concurrent create may be reading the old one
+	tmp, err := os.CreateTemp(filepath.Dir(ebpfSeccompProfilePath), ".ebpf-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to write seccomp profile: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), ebpfSeccompProfilePath)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write seccomp profile: %w", err)
+	}
+	return ebpfSeccompProfilePath, nil
+}
+
+// applyEBPFPrivileges grants spec what eBPF programs need. Privileged mode
+// gives the container full access to the host; otherwise it only gets the
+// selected capabilities and a seccomp profile allowing bpf(). Access to the
+// bpf and tracing filesystems comes from the mount profile.
+func applyEBPFPrivileges(spec *specgen.SpecGenerator, opts CreateOptions) error {
+	if opts.Privileged && len(opts.Capabilities) > 0 {
+		return fmt.Errorf("capabilities cannot be selected for privileged containers")
+	}
+	if opts.Privileged {
+		spec.Privileged = utils.GetPtr(true)
+		spec.CapAdd = []string{"CAP_BPF", "CAP_SYS_ADMIN"}
+		return nil
+	}
+	caps, err := ValidateEBPFCapabilities(opts.Capabilities)
+	if err != nil {
+		return err
+	}
+	profile, err := writeEBPFSeccompProfile()
+	if err != nil {
+		return err
+	}
+	spec.Privileged = utils.GetPtr(false)
+	spec.CapAdd = caps
+	spec.SeccompProfilePath = profile
+
+	return nil
+}
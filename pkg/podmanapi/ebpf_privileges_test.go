@@ -0,0 +1,50 @@
+package podmanapi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/podman/v5/pkg/specgen"
+)
+
+func TestApplyEBPFPrivileges(t *testing.T) {
+	origProfile := ebpfSeccompProfilePath
+	defer func() { ebpfSeccompProfilePath = origProfile }()
+	ebpfSeccompProfilePath = filepath.Join(t.TempDir(), "seccomp", "ebpf.json")
+
+	spec := new(specgen.SpecGenerator)
+	if err := applyEBPFPrivileges(spec, CreateOptions{Capabilities: []string{"bpf", "CAP_PERFMON", "perfmon"}}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if *spec.Privileged || strings.Join(spec.CapAdd, ",") != "CAP_BPF,CAP_PERFMON" {
+		t.Errorf("expected unprivileged container with CAP_BPF and CAP_PERFMON, got: %v, %v", *spec.Privileged, spec.CapAdd)
+	}
+	if spec.SeccompProfilePath != ebpfSeccompProfilePath {
+		t.Errorf("expected seccomp profile to be set, got: %q", spec.SeccompProfilePath)
+	}
+	profile, err := os.ReadFile(ebpfSeccompProfilePath)
+	if err != nil || !strings.Contains(string(profile), `"perf_event_open"`) {
+		t.Errorf("expected profile allowing perf_event_open, got: %v", err)
+	}
+
+	spec = new(specgen.SpecGenerator)
+	if err := applyEBPFPrivileges(spec, CreateOptions{Privileged: true}); err != nil || !*spec.Privileged {
+		t.Errorf("expected privileged container, got: %v", err)
+	}
+
+	if err := applyEBPFPrivileges(new(specgen.SpecGenerator), CreateOptions{Privileged: true, Capabilities: []string{"bpf"}}); err == nil {
+		t.Errorf("expected capabilities of a privileged container to be rejected")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(ebpfSeccompProfilePath)); len(entries) != 1 {
+		t.Errorf("expected only the profile to be left, got: %v", entries)
+	}
+
+	if _, err := ValidateEBPFCapabilities([]string{"CAP_SYS_ADMIN"}); err == nil {
+		t.Errorf("expected CAP_SYS_ADMIN to be rejected")
+	}
+	if caps, _ := ValidateEBPFCapabilities(nil); len(caps) != 3 {
+		t.Errorf("expected all capabilities by default, got: %v", caps)
+	}
+}
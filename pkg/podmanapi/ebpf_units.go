@@ -0,0 +1,235 @@
+package podmanapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+)
+
+// the units a container should run are kept per container name, so they
+// survive restarts of the container and of the API
+var (
+	ebpfUnitsMu        sync.Mutex
+	ebpfUnitsStatePath = "/var/lib/abra/ebpf_units.json"
+)
+
+// Dependency injection variables for testing:
+var (
+	// how long to wait for systemd in a freshly started container
+	systemdBootTimeout  = 60 * time.Second
+	systemdPollInterval = 500 * time.Millisecond
+)
+
+// dialRunningContainer connects to systemd in a running container.
+func dialRunningContainer(ctx context.Context, containerID string) (containerSystemd, error) {
+	contData, err := containersInspect(ctx, containerID, &containers.InspectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if contData.State.Status != define.ContainerStateRunning.String() {
+		return nil, fmt.Errorf("Container is not running")
+	}
+	return dialContainerSystemd(contData.State.Pid)
+}
+
+// changeUnitFile enables or disables an ebpf_ unit and returns its status.
+func changeUnitFile(ctx context.Context, containerID string, service string, enable bool) (EBPFServiceStatus, error) {
+	unit, err := ebpfUnitName(service)
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	conn, err := dialRunningContainer(ctx, containerID)
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	defer conn.Close()
+	if enable {
+		err = conn.EnableUnit(unit)
+	} else {
+		err = conn.DisableUnit(unit)
+	}
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	status, err := conn.UnitStatus(unit)
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	return unitServiceStatus(status), nil
+}
+
+// EnableEBPFService makes an ebpf_ unit start whenever the container boots.
+func EnableEBPFService(ctx context.Context, containerID string, service string) (EBPFServiceStatus, error) {
+	return changeUnitFile(ctx, containerID, service, true)
+}
+
+// DisableEBPFService stops an ebpf_ unit from starting on boot, without
+// stopping it.
+func DisableEBPFService(ctx context.Context, containerID string, service string) (EBPFServiceStatus, error) {
+	return changeUnitFile(ctx, containerID, service, false)
+}
+
+// RestartEBPFService restarts an ebpf_ unit, or starts it if it is stopped.
+func RestartEBPFService(ctx context.Context, containerID string, service string) (EBPFServiceStatus, error) {
+	unit, err := ebpfUnitName(service)
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	conn, err := dialRunningContainer(ctx, containerID)
+	if err != nil {
+		return EBPFServiceStatus{}, err
+	}
+	defer conn.Close()
+	status, err := runUnitAction(conn, "restart", unit)
+	return unitServiceStatus(status), err
+}
+
+func loadDesiredEBPFUnits() (map[string][]string, error) {
+	desired := map[string][]string{}
+	if err := readState(ebpfUnitsStatePath, &desired); err != nil {
+		return nil, err
+	}
+	return desired, nil
+}
+
+// storeDesiredEBPFUnits remembers the units of a container, no units forget it.
+func storeDesiredEBPFUnits(name string, units []string) error {
+	ebpfUnitsMu.Lock()
+	defer ebpfUnitsMu.Unlock()
+	desired, err := loadDesiredEBPFUnits()
+	if err != nil {
+		return err
+	}
+	if _, ok := desired[name]; !ok && len(units) == 0 {
+		return nil
+	}
+	if len(units) == 0 {
+		delete(desired, name)
+	} else {
+		desired[name] = units
+	}
+	return writeState(ebpfUnitsStatePath, desired)
+}
+
+func storedDesiredEBPFUnits(name string) ([]string, error) {
+	ebpfUnitsMu.Lock()
+	defer ebpfUnitsMu.Unlock()
+	desired, err := loadDesiredEBPFUnits()
+	if err != nil {
+		return nil, err
+	}
+	units := desired[name]
+	if units == nil {
+		units = []string{}
+	}
+	return units, nil
+}
+
+// GetDesiredEBPFUnits returns the units that are started whenever the
+// container is started through the API.
+func GetDesiredEBPFUnits(ctx context.Context, containerID string) ([]string, error) {
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return storedDesiredEBPFUnits(inspectData.Name)
+}
+
+// SetDesiredEBPFUnits stores the units a container should run and starts
+// them right away if it is running. An empty list forgets the container.
+func SetDesiredEBPFUnits(ctx context.Context, containerID string, units []string) ([]EBPFBatchResult, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, u := range units {
+		unit, err := ebpfUnitName(u)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[unit] {
+			seen[unit] = true
+			normalized = append(normalized, unit)
+		}
+	}
+	sort.Strings(normalized)
+
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := storeDesiredEBPFUnits(inspectData.Name, normalized); err != nil {
+		return nil, err
+	}
+	if inspectData.State.Status != define.ContainerStateRunning.String() || len(normalized) == 0 {
+		return []EBPFBatchResult{}, nil
+	}
+	target := batchTarget{id: inspectData.ID, name: inspectData.Name, pid: inspectData.State.Pid}
+	return runBatchTarget(target, EBPFBatchRequest{Action: "start", Units: normalized}), nil
+}
+
+// waitForContainerSystemd waits until systemd in a freshly started container
+// accepts connections.
+func waitForContainerSystemd(pid int) error {
+	deadline := time.Now().Add(systemdBootTimeout)
+	for {
+		conn, err := dialContainerSystemd(pid)
+		if err == nil {
+			return conn.Close()
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(systemdPollInterval)
+	}
+}
+
+// ApplyDesiredEBPFUnits starts the stored units of a running container,
+// waiting for its systemd to come up first.
+func ApplyDesiredEBPFUnits(ctx context.Context, containerID string) ([]EBPFBatchResult, error) {
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return nil, err
+	}
+	units, err := storedDesiredEBPFUnits(inspectData.Name)
+	if err != nil || len(units) == 0 {
+		return []EBPFBatchResult{}, err
+	}
+	if inspectData.State.Status != define.ContainerStateRunning.String() {
+		return nil, fmt.Errorf("Container is not running")
+	}
+	if err := waitForContainerSystemd(inspectData.State.Pid); err != nil {
+		return nil, err
+	}
+	target := batchTarget{id: inspectData.ID, name: inspectData.Name, pid: inspectData.State.Pid}
+	return runBatchTarget(target, EBPFBatchRequest{Action: "start", Units: units}), nil
+}
+
+// applyDesiredEBPFUnitsAsync starts the stored units in the background, as
+// systemd in a container that just started may take a while to boot.
+func applyDesiredEBPFUnitsAsync(ctx context.Context, containerID string, name string) {
+	units, err := storedDesiredEBPFUnits(name)
+	if err != nil {
+		log.Printf("Error reading eBPF units of %s: %v", name, err)
+		return
+	}
+	if len(units) == 0 {
+		return
+	}
+	go func() {
+		results, err := ApplyDesiredEBPFUnits(ctx, containerID)
+		if err != nil {
+			log.Printf("Error starting eBPF units of %s: %v", name, err)
+			return
+		}
+		for _, r := range results {
+			if !r.OK {
+				log.Printf("Error starting %s in %s: %s", r.Unit, name, r.Error)
+			}
+		}
+	}()
+}
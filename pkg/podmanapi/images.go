@@ -1,14 +1,26 @@
 package podmanapi
 
 import (
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/containers/podman/v5/pkg/bindings/images"
 	"github.com/containers/podman/v5/pkg/domain/entities/types"
 	"github.com/sonarping/go-nodeapi/pkg/utils"
 )
 
+// Dependency injection variables for testing:
+var (
+	imagesBuild  = images.Build
+	imagesExport = images.Export
+)
+
 func GetImageList(ctx context.Context) ([]*types.ImageSummary, error) {
 	images, err := images.List(ctx, nil)
 	if err != nil {
@@ -30,14 +42,266 @@ func RemoveImage(ctx context.Context, imageID string) (int, error) {
 	return exitReport.ExitCode, nil
 }
 
-func BuildFromDockerFile(ctx context.Context, dockerFile string, imageLabel string) (string, error) {
-	containerFiles := []string{dockerFile}
+// ImageBuildOptions describes a single image build from a Dockerfile and an
+// already extracted build context directory.
+type ImageBuildOptions struct {
+	ContextDir string
+	// relative to ContextDir unless absolute
+	Dockerfile string
+	Tags       []string
+	BuildArgs  map[string]string
+	Target     string
+	NoCache    bool
+	Squash     bool
+}
+
+// BuildImage builds an image from the Dockerfile in opts.ContextDir and tags it
+// with every entry in opts.Tags. Build output is written to out as it arrives.
+func BuildImage(ctx context.Context, opts ImageBuildOptions, out io.Writer) (string, error) {
+	if len(opts.Tags) == 0 {
+		return "", fmt.Errorf("at least one tag is required")
+	}
 	buildOpts := new(types.BuildOptions)
-	buildOpts.Labels = []string{imageLabel}
-	buildOpts.Squash = true
-	buildReport, err := images.Build(ctx, containerFiles, *buildOpts)
+	buildOpts.ContextDirectory = opts.ContextDir
+	buildOpts.Output = opts.Tags[0]
+	buildOpts.AdditionalTags = opts.Tags[1:]
+	buildOpts.Args = opts.BuildArgs
+	buildOpts.Target = opts.Target
+	buildOpts.NoCache = opts.NoCache
+	buildOpts.Squash = opts.Squash
+	buildOpts.Out = out
+	buildOpts.Err = out
+	buildOpts.ReportWriter = out
+	dockerfile := opts.Dockerfile
+	if !filepath.IsAbs(dockerfile) {
+		dockerfile = filepath.Join(opts.ContextDir, dockerfile)
+	}
+	containerFiles := []string{dockerfile}
+	buildReport, err := imagesBuild(ctx, containerFiles, *buildOpts)
 	if err != nil {
 		return "", fmt.Errorf("error building image: %v", err)
 	}
 	return buildReport.ID, nil
 }
+
+// ImageDetails is the subset of image inspect data exposed by the API.
+type ImageDetails struct {
+	ID           string            `json:"id"`
+	Digest       string            `json:"digest"`
+	RepoTags     []string          `json:"repo_tags"`
+	RepoDigests  []string          `json:"repo_digests"`
+	Created      *time.Time        `json:"created"`
+	Architecture string            `json:"architecture"`
+	Os           string            `json:"os"`
+	Entrypoint   []string          `json:"entrypoint"`
+	Cmd          []string          `json:"cmd"`
+	Env          []string          `json:"env"`
+	WorkingDir   string            `json:"working_dir"`
+	User         string            `json:"user"`
+	ExposedPorts []string          `json:"exposed_ports"`
+	Labels       map[string]string `json:"labels"`
+	Size         int64             `json:"size"`
+	VirtualSize  int64             `json:"virtual_size"`
+	Layers       []string          `json:"layers"`
+}
+
+// ImageHistoryEntry describes one layer in the history of an image.
+type ImageHistoryEntry struct {
+	ID        string   `json:"id"`
+	Created   int64    `json:"created"`
+	CreatedBy string   `json:"created_by"`
+	Tags      []string `json:"tags"`
+	Size      int64    `json:"size"`
+	Comment   string   `json:"comment"`
+}
+
+// RegistryCredentials are used to authenticate against a registry when pushing.
+type RegistryCredentials struct {
+	Username      string
+	Password      string
+	SkipTLSVerify bool
+}
+
+// splitImageReference splits "registry/repo:tag" into its repository and tag,
+// defaulting the tag to latest.
+func splitImageReference(ref string) (string, string, error) {
+	if ref == "" || strings.Contains(ref, "@") {
+		return "", "", fmt.Errorf("invalid image reference %q", ref)
+	}
+	lastSlash := strings.LastIndex(ref, "/")
+	if colon := strings.LastIndex(ref, ":"); colon > lastSlash {
+		if colon == len(ref)-1 {
+			return "", "", fmt.Errorf("invalid image reference %q", ref)
+		}
+		return ref[:colon], ref[colon+1:], nil
+	}
+	return ref, "latest", nil
+}
+
+// TagImage adds the reference target (repo[:tag]) to a local image
+func TagImage(ctx context.Context, imageID string, target string) error {
+	repo, tag, err := splitImageReference(target)
+	if err != nil {
+		return err
+	}
+	if err := images.Tag(ctx, imageID, tag, repo, nil); err != nil {
+		return fmt.Errorf("error tagging image: %v", err)
+	}
+	return nil
+}
+
+// UntagImage removes the reference target (repo[:tag]) from a local image
+func UntagImage(ctx context.Context, imageID string, target string) error {
+	repo, tag, err := splitImageReference(target)
+	if err != nil {
+		return err
+	}
+	if err := images.Untag(ctx, imageID, tag, repo, nil); err != nil {
+		return fmt.Errorf("error untagging image: %v", err)
+	}
+	return nil
+}
+
+// PushImage pushes a local image to destination, which defaults to the image name
+func PushImage(ctx context.Context, source string, destination string, creds RegistryCredentials) error {
+	if destination == "" {
+		destination = source
+	}
+	pushOpts := new(images.PushOptions)
+	pushOpts.Quiet = utils.GetPtr(true)
+	if creds.Username != "" {
+		pushOpts.Username = utils.GetPtr(creds.Username)
+		pushOpts.Password = utils.GetPtr(creds.Password)
+	}
+	if creds.SkipTLSVerify {
+		pushOpts.SkipTLSVerify = utils.GetPtr(true)
+	}
+	if err := images.Push(ctx, source, destination, pushOpts); err != nil {
+		return fmt.Errorf("error pushing image: %v", err)
+	}
+	return nil
+}
+
+func InspectImage(ctx context.Context, imageID string) (ImageDetails, error) {
+	data, err := images.GetImage(ctx, imageID, &images.GetOptions{Size: utils.GetPtr(true)})
+	if err != nil {
+		return ImageDetails{}, fmt.Errorf("error inspecting image: %v", err)
+	}
+	details := ImageDetails{
+		ID:           data.ID,
+		Digest:       data.Digest.String(),
+		RepoTags:     data.RepoTags,
+		RepoDigests:  data.RepoDigests,
+		Created:      data.Created,
+		Architecture: data.Architecture,
+		Os:           data.Os,
+		Labels:       data.Labels,
+		Size:         data.Size,
+		VirtualSize:  data.VirtualSize,
+		ExposedPorts: []string{},
+		Layers:       []string{},
+	}
+	if data.Config != nil {
+		details.Entrypoint = data.Config.Entrypoint
+		details.Cmd = data.Config.Cmd
+		details.Env = data.Config.Env
+		details.WorkingDir = data.Config.WorkingDir
+		details.User = data.Config.User
+		for port := range data.Config.ExposedPorts {
+			details.ExposedPorts = append(details.ExposedPorts, port)
+		}
+		sort.Strings(details.ExposedPorts)
+	}
+	if data.RootFS != nil {
+		for _, layer := range data.RootFS.Layers {
+			details.Layers = append(details.Layers, layer.String())
+		}
+	}
+	return details, nil
+}
+
+func GetImageHistory(ctx context.Context, imageID string) ([]ImageHistoryEntry, error) {
+	history, err := images.History(ctx, imageID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error getting image history: %v", err)
+	}
+	entries := make([]ImageHistoryEntry, 0, len(history))
+	for _, h := range history {
+		entries = append(entries, ImageHistoryEntry{
+			ID:        h.ID,
+			Created:   h.Created,
+			CreatedBy: h.CreatedBy,
+			Tags:      h.Tags,
+			Size:      h.Size,
+			Comment:   h.Comment,
+		})
+	}
+	return entries, nil
+}
+
+const (
+	ArchiveFormatDocker = "docker-archive"
+	ArchiveFormatOCI    = "oci-archive"
+)
+
+// validateSaveRequest checks that the images can be written to a single archive
+// of the given format.
+func validateSaveRequest(imageNames []string, format string) error {
+	if len(imageNames) == 0 {
+		return fmt.Errorf("at least one image is required")
+	}
+	switch format {
+	case ArchiveFormatDocker:
+	case ArchiveFormatOCI:
+		if len(imageNames) > 1 {
+			return fmt.Errorf("%s archives can only hold a single image, use %s for multiple images", ArchiveFormatOCI, ArchiveFormatDocker)
+		}
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+	return nil
+}
+
+// SaveImages writes the given local images to w as a tar archive, gzipped
+// when compress is set. All images are checked to exist first so that
+// nothing is written on a bad request.
+func SaveImages(ctx context.Context, imageNames []string, format string, compress bool, w io.Writer) error {
+	if err := validateSaveRequest(imageNames, format); err != nil {
+		return err
+	}
+	for _, name := range imageNames {
+		exists, err := imagesExists(ctx, name, nil)
+		if err != nil {
+			return fmt.Errorf("error checking image %s: %v", name, err)
+		}
+		if !exists {
+			return fmt.Errorf("image %s not found", name)
+		}
+	}
+	exportOpts := new(images.ExportOptions)
+	exportOpts.Format = utils.GetPtr(format)
+	// podman only compresses the dir formats, archives are gzipped here
+	out := w
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+	if err := imagesExport(ctx, imageNames, out, exportOpts); err != nil {
+		return fmt.Errorf("error saving images: %v", err)
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+// LoadImages imports a docker-archive or oci-archive tarball into local storage
+// and returns the references of the loaded images.
+func LoadImages(ctx context.Context, r io.Reader) ([]string, error) {
+	report, err := images.Load(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("error loading images: %v", err)
+	}
+	return report.Names, nil
+}
@@ -0,0 +1,81 @@
+package podmanapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/containers/podman/v5/pkg/bindings/images"
+)
+
+func TestSplitImageReference(t *testing.T) {
+	tests := []struct {
+		ref, repo, tag string
+	}{
+		{"lab", "lab", "latest"},
+		{"lab:v1", "lab", "v1"},
+		{"registry.local:5000/labs/ebpf", "registry.local:5000/labs/ebpf", "latest"},
+		{"registry.local:5000/labs/ebpf:snap-1", "registry.local:5000/labs/ebpf", "snap-1"},
+	}
+	for _, tt := range tests {
+		repo, tag, err := splitImageReference(tt.ref)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", tt.ref, err)
+		}
+		if repo != tt.repo || tag != tt.tag {
+			t.Errorf("%s: expected %s %s, got: %s %s", tt.ref, tt.repo, tt.tag, repo, tag)
+		}
+	}
+	for _, ref := range []string{"", "lab:", "lab@sha256:abcd"} {
+		if _, _, err := splitImageReference(ref); err == nil {
+			t.Errorf("%q: expected error", ref)
+		}
+	}
+}
+
+func TestValidateSaveRequest(t *testing.T) {
+	if err := validateSaveRequest([]string{"a", "b"}, ArchiveFormatDocker); err != nil {
+		t.Errorf("expected multi-image docker archive to be valid, got: %v", err)
+	}
+	if err := validateSaveRequest([]string{"a"}, ArchiveFormatOCI); err != nil {
+		t.Errorf("expected single image oci archive to be valid, got: %v", err)
+	}
+	if err := validateSaveRequest([]string{"a", "b"}, ArchiveFormatOCI); err == nil {
+		t.Errorf("expected multi-image oci archive to be rejected")
+	}
+	if err := validateSaveRequest(nil, ArchiveFormatDocker); err == nil {
+		t.Errorf("expected empty image list to be rejected")
+	}
+	if err := validateSaveRequest([]string{"a"}, "oci-dir"); err == nil {
+		t.Errorf("expected unsupported format to be rejected")
+	}
+}
+
+func TestSaveImages_Compress(t *testing.T) {
+	origExists, origExport := imagesExists, imagesExport
+	defer func() { imagesExists, imagesExport = origExists, origExport }()
+	imagesExists = func(ctx context.Context, name string, _ *images.ExistsOptions) (bool, error) {
+		return true, nil
+	}
+	imagesExport = func(ctx context.Context, names []string, w io.Writer, opts *images.ExportOptions) error {
+		if opts.Compress != nil {
+			t.Errorf("expected podman not to be asked to compress an archive")
+		}
+		_, err := w.Write([]byte("tar data"))
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := SaveImages(context.Background(), []string{"lab"}, ArchiveFormatDocker, true, &buf); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("expected gzipped archive, got: %v", err)
+	}
+	if data, _ := io.ReadAll(gz); string(data) != "tar data" {
+		t.Errorf("unexpected archive content: %q", data)
+	}
+}
@@ -0,0 +1,246 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/sonarping/go-nodeapi/pkg/utils"
+)
+
+const DefaultNetwork = "podman"
+
+// ErrIPUnavailable wraps errors for addresses that cannot be handed out.
+var ErrIPUnavailable = errors.New("IP address unavailable")
+
+// podman only reports addresses of running containers, so addresses handed
+// out to created or stopped environments are remembered here until the
+// owning container is gone.
+var (
+	ipamMu        sync.Mutex
+	ipamStatePath = "/var/lib/abra/ipam.json"
+	// owners whose container is still being created, their leases are kept
+	// although podman does not list the container yet
+	ipamPending = map[string]time.Time{}
+)
+
+// Dependency injection variables for testing:
+var ipamPendingTTL = 10 * time.Minute
+
+// ipLeases maps network name -> IP address -> owning container name.
+type ipLeases map[string]map[string]string
+
+func loadIPLeases() (ipLeases, error) {
+	leases := ipLeases{}
+	if err := readState(ipamStatePath, &leases); err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
+
+func (l ipLeases) save() error {
+	return writeState(ipamStatePath, l)
+}
+
+// AllocateIP leases an address on networkName to owner (a container name).
+// A requested address is validated against the network's subnets and the
+// addresses already in use, otherwise the next free address is returned.
+// The lease is kept while the container is created, ReleaseIP drops it if
+// that fails.
+func AllocateIP(ctx context.Context, networkName string, owner string, requested net.IP) (net.IP, error) {
+	report, err := networkInspect(ctx, networkName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error inspecting network %s: %v", networkName, err)
+	}
+	if len(report.Subnets) == 0 {
+		return nil, fmt.Errorf("network %s has no subnets to allocate from", networkName)
+	}
+
+	ipamMu.Lock()
+	defer ipamMu.Unlock()
+	// listed under the lock, so creates that finished meanwhile are seen
+	ctrList, err := containersList(ctx, &containers.ListOptions{All: utils.GetPtr(true)})
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %v", err)
+	}
+	existing := map[string]bool{}
+	for _, ctr := range ctrList {
+		for _, name := range ctr.Names {
+			existing[name] = true
+		}
+	}
+	for pendingOwner, since := range ipamPending {
+		// created by now, or the create died without releasing the lease
+		if existing[pendingOwner] || time.Since(since) > ipamPendingTTL {
+			delete(ipamPending, pendingOwner)
+		}
+	}
+	leases, err := loadIPLeases()
+	if err != nil {
+		return nil, err
+	}
+	// forget leases of removed containers
+	for netName, netLeases := range leases {
+		for ip, leaseOwner := range netLeases {
+			if _, pending := ipamPending[leaseOwner]; !existing[leaseOwner] && !pending {
+				delete(netLeases, ip)
+			}
+		}
+		if len(netLeases) == 0 {
+			delete(leases, netName)
+		}
+	}
+
+	used := map[string]string{}
+	for ip, leaseOwner := range leases[networkName] {
+		used[ip] = leaseOwner
+	}
+	for _, ctr := range report.Containers {
+		for _, iface := range ctr.Interfaces {
+			for _, addr := range iface.Subnets {
+				used[addr.IPNet.IP.String()] = ctr.Name
+			}
+		}
+	}
+
+	ip, err := pickIP(report.Subnets, requested, used)
+	if err != nil {
+		return nil, err
+	}
+	if leases[networkName] == nil {
+		leases[networkName] = map[string]string{}
+	}
+	leases[networkName][ip.String()] = owner
+	if err := leases.save(); err != nil {
+		return nil, err
+	}
+	ipamPending[owner] = time.Now()
+	return ip, nil
+}
+
+// ReleaseIP drops the lease owner holds on networkName, e.g. after a failed create.
+func ReleaseIP(networkName string, owner string) error {
+	ipamMu.Lock()
+	defer ipamMu.Unlock()
+	delete(ipamPending, owner)
+	leases, err := loadIPLeases()
+	if err != nil {
+		return err
+	}
+	for ip, leaseOwner := range leases[networkName] {
+		if leaseOwner == owner {
+			delete(leases[networkName], ip)
+		}
+	}
+	return leases.save()
+}
+
+// pickIP validates requested or finds the first free address, preferring
+// IPv4 subnets and honouring their lease ranges.
+func pickIP(subnets []types.Subnet, requested net.IP, used map[string]string) (net.IP, error) {
+	if requested != nil {
+		for _, subnet := range subnets {
+			if !subnet.Subnet.Contains(requested) {
+				continue
+			}
+			if reason := reservedReason(subnet, requested); reason != "" {
+				return nil, fmt.Errorf("%w: %s is the %s of subnet %s", ErrIPUnavailable, requested, reason, subnet.Subnet.String())
+			}
+			if leaseOwner, ok := used[requested.String()]; ok {
+				return nil, fmt.Errorf("%w: %s is already in use by %s", ErrIPUnavailable, requested, leaseOwner)
+			}
+			return requested, nil
+		}
+		var cidrs []string
+		for _, subnet := range subnets {
+			cidrs = append(cidrs, subnet.Subnet.String())
+		}
+		return nil, fmt.Errorf("%w: %s is not in the network subnets %s", ErrIPUnavailable, requested, strings.Join(cidrs, ", "))
+	}
+
+	ordered := make([]types.Subnet, 0, len(subnets))
+	for _, subnet := range subnets {
+		if subnet.Subnet.IP.To4() != nil {
+			ordered = append(ordered, subnet)
+		}
+	}
+	for _, subnet := range subnets {
+		if subnet.Subnet.IP.To4() == nil {
+			ordered = append(ordered, subnet)
+		}
+	}
+	for _, subnet := range ordered {
+		start := nextIP(subnet.Subnet.IP)
+		end := lastIP(subnet.Subnet.IPNet)
+		if subnet.LeaseRange != nil {
+			if subnet.LeaseRange.StartIP != nil {
+				start = subnet.LeaseRange.StartIP
+			}
+			if subnet.LeaseRange.EndIP != nil {
+				end = subnet.LeaseRange.EndIP
+			}
+		}
+		for ip := normalizeIP(start); subnet.Subnet.Contains(ip); ip = nextIP(ip) {
+			if reservedReason(subnet, ip) == "" {
+				if _, ok := used[ip.String()]; !ok {
+					return ip, nil
+				}
+			}
+			if ip.Equal(end) {
+				break
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: no free addresses left on the network", ErrIPUnavailable)
+}
+
+// reservedReason reports why ip can never be assigned to a container, if so.
+func reservedReason(subnet types.Subnet, ip net.IP) string {
+	switch {
+	case ip.Equal(subnet.Subnet.IP):
+		return "network address"
+	case subnet.Gateway != nil && ip.Equal(subnet.Gateway):
+		return "gateway"
+	case ip.To4() != nil && ip.Equal(lastIP(subnet.Subnet.IPNet)):
+		return "broadcast address"
+	}
+	return ""
+}
+
+// normalizeIP returns the 4 byte form of IPv4 addresses.
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP(nil), normalizeIP(ip)...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func lastIP(ipNet net.IPNet) net.IP {
+	ip := normalizeIP(ipNet.IP)
+	last := make(net.IP, len(ip))
+	mask := ipNet.Mask
+	if len(mask) != len(ip) {
+		mask = mask[len(mask)-len(ip):]
+	}
+	for i := range ip {
+		last[i] = ip[i] | ^mask[i]
+	}
+	return last
+}
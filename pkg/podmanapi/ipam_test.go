@@ -0,0 +1,181 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/bindings/network"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+	"github.com/containers/podman/v5/pkg/specgen"
+)
+
+func testSubnet(cidr string, gateway string) types.Subnet {
+	_, ipNet, _ := net.ParseCIDR(cidr)
+	return types.Subnet{Subnet: types.IPNet{IPNet: *ipNet}, Gateway: net.ParseIP(gateway)}
+}
+
+func TestPickIP(t *testing.T) {
+	subnets := []types.Subnet{
+		testSubnet("fd00:90::/64", "fd00:90::1"),
+		testSubnet("10.90.0.0/24", "10.90.0.1"),
+	}
+	used := map[string]string{"10.90.0.2": "env1"}
+
+	ip, err := pickIP(subnets, nil, used)
+	if err != nil || ip.String() != "10.90.0.3" {
+		t.Fatalf("expected next free IPv4 10.90.0.3, got: %v %v", ip, err)
+	}
+
+	for _, requested := range []string{"10.90.0.2", "10.90.0.1", "10.90.0.255", "10.91.0.5"} {
+		if _, err := pickIP(subnets, net.ParseIP(requested), used); !errors.Is(err, ErrIPUnavailable) {
+			t.Errorf("expected %s to be unavailable, got: %v", requested, err)
+		}
+	}
+	if ip, err := pickIP(subnets, net.ParseIP("10.90.0.50"), used); err != nil || ip.String() != "10.90.0.50" {
+		t.Errorf("expected requested IP to be accepted, got: %v %v", ip, err)
+	}
+
+	ranged := testSubnet("10.90.0.0/24", "10.90.0.1")
+	ranged.LeaseRange = &types.LeaseRange{StartIP: net.ParseIP("10.90.0.200"), EndIP: net.ParseIP("10.90.0.201")}
+	used = map[string]string{"10.90.0.200": "env1", "10.90.0.201": "env2"}
+	if _, err := pickIP([]types.Subnet{ranged}, nil, used); !errors.Is(err, ErrIPUnavailable) {
+		t.Errorf("expected exhausted lease range, got: %v", err)
+	}
+}
+
+func TestAllocateIP_TracksLeases(t *testing.T) {
+	origInspect := networkInspect
+	origList := containersList
+	origPath := ipamStatePath
+	origPending := ipamPending
+	defer func() {
+		networkInspect = origInspect
+		containersList = origList
+		ipamStatePath = origPath
+		ipamPending = origPending
+	}()
+	ipamPending = map[string]time.Time{}
+	ipamStatePath = filepath.Join(t.TempDir(), "ipam.json")
+
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		report := entitiesTypes.NetworkInspectReport{}
+		report.Name = nameOrID
+		report.Subnets = []types.Subnet{testSubnet("10.90.0.0/24", "10.90.0.1")}
+		return report, nil
+	}
+	existing := []entitiesTypes.ListContainer{}
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return existing, nil
+	}
+
+	first, err := AllocateIP(context.Background(), "labnet", "env1", nil)
+	if err != nil || first.String() != "10.90.0.2" {
+		t.Fatalf("expected 10.90.0.2, got: %v %v", first, err)
+	}
+	// env1 was created but is not running, so only the lease marks it used
+	existing = append(existing, entitiesTypes.ListContainer{Names: []string{"env1"}})
+	second, err := AllocateIP(context.Background(), "labnet", "env2", nil)
+	if err != nil || second.String() != "10.90.0.3" {
+		t.Fatalf("expected 10.90.0.3, got: %v %v", second, err)
+	}
+	if _, err := AllocateIP(context.Background(), "labnet", "env3", first); !errors.Is(err, ErrIPUnavailable) {
+		t.Fatalf("expected leased IP to be rejected, got: %v", err)
+	}
+
+	// env2 is still being created, env1 has been removed
+	existing = nil
+	if _, err := AllocateIP(context.Background(), "labnet", "env3", second); !errors.Is(err, ErrIPUnavailable) {
+		t.Fatalf("expected lease of a container being created to be kept, got: %v", err)
+	}
+	if err := ReleaseIP("labnet", "env3"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := AllocateIP(context.Background(), "labnet", "env3", first)
+	if err != nil || !again.Equal(first) {
+		t.Fatalf("expected lease of removed container to be reusable, got: %v %v", again, err)
+	}
+}
+
+func TestAllocateIP_PendingLeaseExpires(t *testing.T) {
+	origInspect, origList, origPath := networkInspect, containersList, ipamStatePath
+	origPending, origTTL := ipamPending, ipamPendingTTL
+	defer func() {
+		networkInspect, containersList, ipamStatePath = origInspect, origList, origPath
+		ipamPending, ipamPendingTTL = origPending, origTTL
+	}()
+	ipamStatePath = filepath.Join(t.TempDir(), "ipam.json")
+	ipamPending = map[string]time.Time{}
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		report := entitiesTypes.NetworkInspectReport{}
+		report.Subnets = []types.Subnet{testSubnet("10.90.0.0/24", "10.90.0.1")}
+		return report, nil
+	}
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return nil, nil
+	}
+
+	first, err := AllocateIP(context.Background(), "labnet", "env1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the create of env1 crashed without releasing its lease
+	ipamPendingTTL = 0
+	again, err := AllocateIP(context.Background(), "labnet", "env2", nil)
+	if err != nil || !again.Equal(first) {
+		t.Errorf("expected expired pending lease to be reusable, got: %v %v", again, err)
+	}
+}
+
+func TestCreateContainer_LeasesUnrequestedIP(t *testing.T) {
+	origInspect, origList, origCreate, origPath := networkInspect, containersList, containersCreate, ipamStatePath
+	origPending, origBandwidth := ipamPending, bandwidthStatePath
+	defer func() {
+		networkInspect, containersList, containersCreate, ipamStatePath = origInspect, origList, origCreate, origPath
+		ipamPending, bandwidthStatePath = origPending, origBandwidth
+	}()
+	ipamStatePath = filepath.Join(t.TempDir(), "ipam.json")
+	bandwidthStatePath = filepath.Join(t.TempDir(), "bandwidth.json")
+	ipamPending = map[string]time.Time{}
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		report := entitiesTypes.NetworkInspectReport{}
+		report.Name = nameOrID
+		if nameOrID == "labnet" {
+			report.Subnets = []types.Subnet{testSubnet("10.90.0.0/24", "10.90.0.1")}
+		}
+		return report, nil
+	}
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return nil, nil
+	}
+	var created *specgen.SpecGenerator
+	containersCreate = func(ctx context.Context, s *specgen.SpecGenerator, _ *containers.CreateOptions) (entitiesTypes.ContainerCreateResponse, error) {
+		created = s
+		return entitiesTypes.ContainerCreateResponse{ID: s.Name}, nil
+	}
+
+	spec := specgen.NewSpecGenerator("alpine", false)
+	spec.Name = "env1"
+	if _, err := createContainer(context.Background(), spec, CreateOptions{Network: "labnet"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ips := created.Networks["labnet"].StaticIPs
+	if len(ips) != 1 || ips[0].String() != "10.90.0.2" {
+		t.Errorf("expected the next free IP to be pinned, got: %v", ips)
+	}
+
+	// without subnets the address is left to podman
+	spec = specgen.NewSpecGenerator("alpine", false)
+	spec.Name = "env2"
+	if _, err := createContainer(context.Background(), spec, CreateOptions{Network: "dhcp"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if ips := created.Networks["dhcp"].StaticIPs; len(ips) != 0 {
+		t.Errorf("expected no IP to be pinned, got: %v", ips)
+	}
+}
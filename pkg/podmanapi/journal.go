@@ -0,0 +1,231 @@
+package podmanapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+)
+
+const defaultJournalLines = 100
+
+// Dependency injection variables for testing:
+var runJournalctlFunc = runJournalctl
+
+var journalPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// JournalOptions select the journal entries of a unit.
+type JournalOptions struct {
+	// number of most recent entries, 0 uses the default of 100
+	Lines int
+	// unix timestamp or any time specification journalctl accepts
+	Since string
+	// maximum priority, 0-7 or a name like "err"
+	Priority string
+	// keep streaming new entries until ctx is done
+	Follow bool
+}
+
+// JournalEntry is one journal record of a unit.
+type JournalEntry struct {
+	// unix time in microseconds
+	Time     int64  `json:"time"`
+	Priority int    `json:"priority"`
+	PID      int    `json:"pid,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ebpfUnitName validates an ebpf_ service name and adds the .service suffix.
+func ebpfUnitName(service string) (string, error) {
+	name := strings.TrimSuffix(service, ".service")
+	if !ebpfUnitRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid service name %q, expected ebpf_<name>", service)
+	}
+	return name + ".service", nil
+}
+
+func (o JournalOptions) Validate() error {
+	if o.Lines < 0 {
+		return fmt.Errorf("lines must not be negative")
+	}
+	if o.Priority != "" {
+		valid := false
+		for i, p := range journalPriorities {
+			if o.Priority == p || o.Priority == strconv.Itoa(i) {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid priority %q", o.Priority)
+		}
+	}
+	return nil
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+// journalArgs builds the journalctl arguments for unit in the container
+// filesystem at root.
+func journalArgs(root string, unit string, opts JournalOptions, output string) []string {
+	lines := opts.Lines
+	if lines == 0 {
+		lines = defaultJournalLines
+	}
+	args := []string{"--root", root, "--unit", unit, "--no-pager", "--output", output, "--lines", strconv.Itoa(lines)}
+	if opts.Since != "" {
+		since := opts.Since
+		if isInteger(since) {
+			since = "@" + since
+		}
+		args = append(args, "--since", since)
+	}
+	if opts.Priority != "" {
+		args = append(args, "--priority", opts.Priority)
+	}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	return args
+}
+
+// containerRoot returns the host path of a running container's root filesystem.
+func containerRoot(ctx context.Context, containerID string) (string, error) {
+	contData, err := containersInspect(ctx, containerID, &containers.InspectOptions{})
+	if err != nil {
+		return "", err
+	}
+	if contData.State.Status != define.ContainerStateRunning.String() {
+		return "", fmt.Errorf("Container is not running")
+	}
+	return filepath.Join(procRoot, strconv.Itoa(contData.State.Pid), "root"), nil
+}
+
+// GetEBPFServiceLogs returns the journal entries of an ebpf_ unit inside a
+// container, oldest first.
+func GetEBPFServiceLogs(ctx context.Context, containerID string, service string, opts JournalOptions) ([]JournalEntry, error) {
+	unit, err := ebpfUnitName(service)
+	if err != nil {
+		return nil, err
+	}
+	opts.Follow = false
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	root, err := containerRoot(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := runJournalctlFunc(ctx, journalArgs(root, unit, opts, "json"), &out); err != nil {
+		return nil, err
+	}
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(&out)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry, err := parseJournalEntry(scanner.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// StreamEBPFServiceLogs writes the journal of an ebpf_ unit as text to w,
+// following new entries if requested until ctx is done.
+func StreamEBPFServiceLogs(ctx context.Context, containerID string, service string, opts JournalOptions, w io.Writer) error {
+	unit, err := ebpfUnitName(service)
+	if err != nil {
+		return err
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	root, err := containerRoot(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	return runJournalctlFunc(ctx, journalArgs(root, unit, opts, "short-iso"), w)
+}
+
+// RecentEBPFServiceLogs returns the last lines of a unit's journal as text,
+// for error messages. Failures to read the journal are ignored.
+func RecentEBPFServiceLogs(ctx context.Context, containerID string, service string, lines int) []string {
+	entries, err := GetEBPFServiceLogs(ctx, containerID, service, JournalOptions{Lines: lines})
+	if err != nil {
+		return nil
+	}
+	messages := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ts := time.UnixMicro(e.Time).UTC().Format(time.RFC3339)
+		messages = append(messages, fmt.Sprintf("%s %s", ts, e.Message))
+	}
+	return messages
+}
+
+// parseJournalEntry decodes one line of journalctl --output json. Fields are
+// strings, or byte arrays when they are not valid UTF-8.
+func parseJournalEntry(line []byte) (JournalEntry, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return JournalEntry{}, fmt.Errorf("error parsing journal entry: %v", err)
+	}
+	entry := JournalEntry{Priority: 6}
+	entry.Time, _ = strconv.ParseInt(journalField(fields["__REALTIME_TIMESTAMP"]), 10, 64)
+	if p, err := strconv.Atoi(journalField(fields["PRIORITY"])); err == nil {
+		entry.Priority = p
+	}
+	entry.PID, _ = strconv.Atoi(journalField(fields["_PID"]))
+	entry.Message = journalField(fields["MESSAGE"])
+	return entry, nil
+}
+
+func journalField(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var b []byte
+	var ints []int
+	if err := json.Unmarshal(raw, &ints); err == nil {
+		for _, i := range ints {
+			b = append(b, byte(i))
+		}
+		return string(b)
+	}
+	return ""
+}
+
+func runJournalctl(ctx context.Context, args []string, w io.Writer) error {
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("journalctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package podmanapi
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestGetEBPFServiceLogs(t *testing.T) {
+	withFakeSystemd(t, &fakeSystemd{})
+	origRun := runJournalctlFunc
+	defer func() { runJournalctlFunc = origRun }()
+
+	var gotArgs []string
+	runJournalctlFunc = func(ctx context.Context, args []string, w io.Writer) error {
+		gotArgs = args
+		io.WriteString(w, `{"__REALTIME_TIMESTAMP":"1700000000000000","PRIORITY":"3","_PID":"42","MESSAGE":"failed to attach kprobe"}`+"\n")
+		io.WriteString(w, `{"__REALTIME_TIMESTAMP":"1700000001000000","MESSAGE":[104,105]}`+"\n")
+		return nil
+	}
+
+	entries, err := GetEBPFServiceLogs(context.Background(), "abc", "ebpf_trace", JournalOptions{Lines: 5, Since: "1699999999", Priority: "err"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	args := strings.Join(gotArgs, " ")
+	want := "--root /proc/4242/root --unit ebpf_trace.service --no-pager --output json --lines 5 --since @1699999999 --priority err"
+	if args != want {
+		t.Errorf("unexpected journalctl args:\n got: %s\nwant: %s", args, want)
+	}
+	if len(entries) != 2 || entries[0].Priority != 3 || entries[0].PID != 42 || entries[0].Message != "failed to attach kprobe" {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+	if entries[1].Message != "hi" || entries[1].Priority != 6 {
+		t.Errorf("expected byte array message to be decoded, got: %#v", entries[1])
+	}
+
+	if _, err := GetEBPFServiceLogs(context.Background(), "abc", "sshd", JournalOptions{}); err == nil {
+		t.Errorf("expected non ebpf_ units to be rejected")
+	}
+	if _, err := GetEBPFServiceLogs(context.Background(), "abc", "ebpf_trace", JournalOptions{Priority: "loud"}); err == nil {
+		t.Errorf("expected invalid priority to be rejected")
+	}
+}
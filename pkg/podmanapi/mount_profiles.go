@@ -0,0 +1,144 @@
+package podmanapi
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sonarping/go-nodeapi/pkg/config"
+)
+
+const defaultMountProfile = "networking"
+
+// Dependency injection variables for testing:
+var ebpfConfig = currentEBPFConfig
+
+func currentEBPFConfig() (config.EBPFConfig, error) {
+	cfg, err := config.Get()
+	if err != nil {
+		return config.EBPFConfig{}, err
+	}
+	return cfg.EBPF, nil
+}
+
+// systemd in the container needs the cgroup tree and a tmpfs /run
+var baseMounts = []config.Mount{
+	{Type: "bind", Source: "/sys/fs/cgroup", Destination: "/sys/fs/cgroup", ReadOnly: true},
+	{Type: "tmpfs", Destination: "/run", Options: []string{"nosuid", "nodev", "noexec"}},
+	{Type: "tmpfs", Destination: "/run/lock", Options: []string{"nosuid", "nodev", "noexec"}},
+}
+
+// kernel headers and modules for compiling programs in the container
+var kernelMounts = []config.Mount{
+	{Type: "bind", Source: "/usr/src/kernels/{kernel}", Destination: "/usr/src/kernels/{kernel}", ReadOnly: true},
+	{Type: "bind", Source: "/lib/modules/{kernel}", Destination: "/lib/modules/{kernel}", ReadOnly: true},
+}
+
+// each container pins into a bpf filesystem of its own, the host's and other
+// containers' pinned objects stay out of reach
+var bpffsMount = config.Mount{Type: "bpf", Destination: bpffsRoot}
+
+// builtinMountProfiles are available unless the config replaces them. Host
+// directories are mounted read-only; tracing, which exposes the host's
+// tracefs and debugfs, has to be selected explicitly.
+func builtinMountProfiles() map[string][]config.Mount {
+	concat := func(sets ...[]config.Mount) []config.Mount {
+		mounts := []config.Mount{}
+		for _, s := range sets {
+			mounts = append(mounts, s...)
+		}
+		return mounts
+	}
+	return map[string][]config.Mount{
+		"minimal":    concat(baseMounts, []config.Mount{bpffsMount}),
+		"networking": concat(baseMounts, kernelMounts, []config.Mount{bpffsMount}),
+		"tracing": concat(baseMounts, kernelMounts, []config.Mount{
+			bpffsMount,
+			{Type: "bind", Source: "/sys/kernel/tracing", Destination: "/sys/kernel/tracing", ReadOnly: true},
+			{Type: "bind", Source: "/sys/kernel/debug", Destination: "/sys/kernel/debug", ReadOnly: true},
+		}),
+	}
+}
+
+// MountProfiles returns the built-in and configured mount profiles and the
+// name of the default one.
+func MountProfiles() (map[string][]config.Mount, string, error) {
+	cfg, err := ebpfConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	profiles := builtinMountProfiles()
+	for name, mounts := range cfg.MountProfiles {
+		profiles[name] = mounts
+	}
+	def := cfg.DefaultMountProfile
+	if def == "" {
+		def = defaultMountProfile
+	}
+	if _, ok := profiles[def]; !ok {
+		return nil, "", fmt.Errorf("default mount profile %s is not defined", def)
+	}
+	return profiles, def, nil
+}
+
+// ValidateMountProfile checks a requested profile exists, empty selects the
+// default.
+func ValidateMountProfile(name string) error {
+	profiles, _, err := MountProfiles()
+	if err != nil {
+		return err
+	}
+	if _, ok := profiles[name]; name != "" && !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown mount profile %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// profileMounts resolves a profile for the running kernel. Missing bind
+// sources on the host fail with ErrEBPFNotReady.
+func profileMounts(name string, kernel string) ([]specs.Mount, error) {
+	profiles, def, err := MountProfiles()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = def
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mount profile %q", name)
+	}
+	mounts := []specs.Mount{}
+	missing := []string{}
+	for _, m := range profile {
+		source := strings.ReplaceAll(m.Source, "{kernel}", kernel)
+		mount := specs.Mount{
+			Type:        m.Type,
+			Source:      source,
+			Destination: strings.ReplaceAll(m.Destination, "{kernel}", kernel),
+			Options:     append([]string{}, m.Options...),
+		}
+		if m.ReadOnly {
+			mount.Options = append([]string{"ro"}, mount.Options...)
+		} else {
+			mount.Options = append([]string{"rw"}, mount.Options...)
+		}
+		if m.Type == "tmpfs" || m.Type == "bpf" {
+			mount.Source = m.Type
+		} else if _, err := os.Stat(hostPath(source)); err != nil {
+			missing = append(missing, source)
+		}
+		mounts = append(mounts, mount)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: mount profile %s needs %s on the host", ErrEBPFNotReady, name, strings.Join(missing, ", "))
+	}
+	return mounts, nil
+}
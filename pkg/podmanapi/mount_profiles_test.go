@@ -0,0 +1,66 @@
+package podmanapi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sonarping/go-nodeapi/pkg/config"
+)
+
+func TestProfileMounts(t *testing.T) {
+	origSys, origConfig := sysRoot, ebpfConfig
+	defer func() { sysRoot, ebpfConfig = origSys, origConfig }()
+	sysRoot = t.TempDir()
+	ebpfConfig = func() (config.EBPFConfig, error) {
+		return config.EBPFConfig{
+			DefaultMountProfile: "xdp",
+			MountProfiles: map[string][]config.Mount{
+				"xdp": {
+					{Type: "bind", Source: "/lib/modules/{kernel}", Destination: "/lib/modules/{kernel}", ReadOnly: true},
+					{Type: "tmpfs", Destination: "/run", Options: []string{"nosuid"}},
+				},
+			},
+		}, nil
+	}
+
+	if _, err := profileMounts("", "6.8.0-test"); !errors.Is(err, ErrEBPFNotReady) {
+		t.Errorf("expected missing modules to fail with ErrEBPFNotReady, got: %v", err)
+	}
+	os.MkdirAll(filepath.Join(sysRoot, "lib/modules/6.8.0-test"), 0755)
+	mounts, err := profileMounts("", "6.8.0-test")
+	if err != nil {
+		t.Fatalf("profileMounts: %v", err)
+	}
+	expected := []specs.Mount{
+		{Type: "bind", Source: "/lib/modules/6.8.0-test", Destination: "/lib/modules/6.8.0-test", Options: []string{"ro"}},
+		{Type: "tmpfs", Source: "tmpfs", Destination: "/run", Options: []string{"rw", "nosuid"}},
+	}
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Errorf("unexpected mounts: %#v", mounts)
+	}
+
+	// built-in profiles stay available next to the configured ones
+	if err := ValidateMountProfile("minimal"); err != nil {
+		t.Errorf("expected minimal to be valid, got: %v", err)
+	}
+	if err := ValidateMountProfile("unknown"); err == nil {
+		t.Errorf("expected unknown profile to be rejected")
+	}
+}
+
+func TestBuiltinMountProfiles(t *testing.T) {
+	for name, mounts := range builtinMountProfiles() {
+		for _, m := range mounts {
+			if m.Type == "bind" && !m.ReadOnly {
+				t.Errorf("%s: host path %s is mounted writable", name, m.Source)
+			}
+			if m.Destination == bpffsRoot && m.Type != "bpf" {
+				t.Errorf("%s: expected a bpf filesystem of the container's own, got: %#v", name, m)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package podmanapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/bindings/system"
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
+	"github.com/sonarping/go-nodeapi/pkg/netpolicy"
+	"github.com/sonarping/go-nodeapi/pkg/utils"
+)
+
+// Dependency injection variables for testing:
+var (
+	systemEvents         = system.Events
+	applyNetworkPolicies = netpolicy.Apply
+	netpolicyList        = netpolicy.List
+)
+
+// reconciles triggered by the API and by podman events must not interleave
+var netpolicyMu sync.Mutex
+
+// ReconcileNetworkPolicies regenerates the isolation rules from the stored
+// policies and the addresses of the running containers.
+func ReconcileNetworkPolicies(ctx context.Context) error {
+	netpolicyMu.Lock()
+	defer netpolicyMu.Unlock()
+
+	policies, err := netpolicyList()
+	if err != nil {
+		return err
+	}
+	var endpoints []netpolicy.Endpoint
+	if len(policies) > 0 {
+		ctrList, err := containersList(ctx, &containers.ListOptions{
+			Filters: map[string][]string{"status": {"running"}},
+		})
+		if err != nil {
+			return fmt.Errorf("error listing containers: %v", err)
+		}
+		for _, ctr := range ctrList {
+			if len(ctr.Names) == 0 {
+				continue
+			}
+			policy, ok := policies[ctr.Names[0]]
+			if !ok {
+				continue
+			}
+			ep, err := policyEndpoint(ctx, ctr.ID, ctr.Names[0], policy)
+			if err != nil {
+				// stopped or removed since the list, its rules go with it
+				log.Printf("Skipping network policy of %s: %v", ctr.Names[0], err)
+				continue
+			}
+			endpoints = append(endpoints, ep)
+		}
+	}
+	return applyNetworkPolicies(endpoints)
+}
+
+func policyEndpoint(ctx context.Context, containerID string, name string, policy netpolicy.Policy) (netpolicy.Endpoint, error) {
+	ep := netpolicy.Endpoint{Name: name, Policy: policy}
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return ep, fmt.Errorf("error inspecting container %s: %v", name, err)
+	}
+	if inspectData.NetworkSettings == nil {
+		return ep, nil
+	}
+	for _, ns := range inspectData.NetworkSettings.Networks {
+		for _, addr := range []string{ns.IPAddress, ns.GlobalIPv6Address} {
+			if ip := net.ParseIP(addr); ip != nil {
+				ep.IPs = append(ep.IPs, ip)
+			}
+		}
+		for _, addr := range []string{ns.Gateway, ns.IPv6Gateway} {
+			if ip := net.ParseIP(addr); ip != nil {
+				ep.Gateways = append(ep.Gateways, ip)
+			}
+		}
+	}
+	return ep, nil
+}
+
+// StartNetworkWatcher reconciles the isolation rules and reapplies
+// bandwidth limits and output collectors whenever a container starts, stops
+// or changes networks, including restarts podman does on its own.
+func StartNetworkWatcher(ctx context.Context) {
+	go func() {
+		for {
+			if err := ReconcileNetworkPolicies(ctx); err != nil {
+				log.Printf("Error reconciling network policies: %v", err)
+			}
+			eventChan := make(chan types.Event)
+			cancelChan := make(chan bool, 1)
+			err := systemEvents(ctx, eventChan, cancelChan, &system.EventsOptions{
+				Stream: utils.GetPtr(true),
+				Filters: map[string][]string{
+					"type":  {"container", "network"},
+					"event": {"start", "restart", "died", "stop", "remove", "connect", "disconnect"},
+				},
+			})
+			if err != nil {
+				log.Printf("Error watching container events: %v", err)
+			} else {
+				watchNetworkEvents(ctx, eventChan)
+				cancelChan <- true
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+}
+
+func watchNetworkEvents(ctx context.Context, eventChan chan types.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-eventChan:
+			if !ok {
+				return
+			}
+			if err := ReconcileNetworkPolicies(ctx); err != nil {
+				log.Printf("Error reconciling network policies: %v", err)
+			}
+			if e.Type == "container" && (e.Action == "start" || e.Action == "restart") {
+				if err := ApplyStoredBandwidth(ctx, e.Actor.ID); err != nil {
+					log.Printf("Error applying bandwidth limits to %s: %v", e.Actor.ID, err)
+				}
+				if err := StartOutputCollectors(ctx, e.Actor.ID); err != nil {
+					log.Printf("Error starting output collectors of %s: %v", e.Actor.ID, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package podmanapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+	"github.com/sonarping/go-nodeapi/pkg/netpolicy"
+)
+
+func TestReconcileNetworkPolicies_SkipsVanishedContainers(t *testing.T) {
+	origList, origPolicies, origApply, origInspect := containersList, netpolicyList, applyNetworkPolicies, containersInspect
+	defer func() {
+		containersList, netpolicyList, applyNetworkPolicies, containersInspect = origList, origPolicies, origApply, origInspect
+	}()
+	netpolicyList = func() (map[string]netpolicy.Policy, error) {
+		return map[string]netpolicy.Policy{"env1": {}, "env2": {}}, nil
+	}
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return []entitiesTypes.ListContainer{{ID: "a", Names: []string{"env1"}}, {ID: "b", Names: []string{"env2"}}}, nil
+	}
+	// env2 stopped between the list and the inspect
+	containersInspect = func(ctx context.Context, nameOrID string, _ *containers.InspectOptions) (*define.InspectContainerData, error) {
+		if nameOrID == "b" {
+			return nil, fmt.Errorf("no such container")
+		}
+		return &define.InspectContainerData{Name: "env1"}, nil
+	}
+	var applied []netpolicy.Endpoint
+	applyNetworkPolicies = func(endpoints []netpolicy.Endpoint) error {
+		applied = endpoints
+		return nil
+	}
+
+	if err := ReconcileNetworkPolicies(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Name != "env1" {
+		t.Errorf("expected the rules of env1 to be applied, got: %#v", applied)
+	}
+}
@@ -1,29 +1,154 @@
 package podmanapi
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log"
 	"net"
+	"regexp"
+	"sort"
 
 	"github.com/containers/common/libnetwork/types"
 	"github.com/containers/podman/v5/pkg/bindings/network"
+	"github.com/sonarping/go-nodeapi/pkg/utils"
 )
 
-func InitNewNetwork(ctx context.Context, name string, subnet net.IPNet, gateway net.IP) error {
-	ipNet := types.IPNet{
-		subnet,
+// Dependency injection variables for testing:
+var (
+	networkConnect    = network.Connect
+	networkDisconnect = network.Disconnect
+	networkInspect    = network.Inspect
+	networkList       = network.List
+)
+
+const (
+	NetworkDriverBridge  = "bridge"
+	NetworkDriverMacvlan = "macvlan"
+	NetworkDriverIPvlan  = "ipvlan"
+)
+
+var networkNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// NetworkCreateOptions describes a network to create. Parent is the host
+// interface used by macvlan and ipvlan networks.
+type NetworkCreateOptions struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Parent     string            `json:"parent"`
+	Subnets    []NetworkSubnet   `json:"subnets"`
+	Internal   bool              `json:"internal"`
+	DNSEnabled bool              `json:"dns_enabled"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// buildNetwork validates opts and converts them to a libnetwork network.
+func buildNetwork(opts NetworkCreateOptions) (*types.Network, error) {
+	if !networkNameRegexp.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid network name %q", opts.Name)
 	}
 	netOptions := new(types.Network)
-	netOptions.Name = name
-	netOptions.ID = name
-	netOptions.Subnets = []types.Subnet{
-		{
-			Subnet:  ipNet,
-			Gateway: gateway,
-		},
-	}
-	netOptions.Internal = false
+	netOptions.Name = opts.Name
+	netOptions.Driver = opts.Driver
+	if netOptions.Driver == "" {
+		netOptions.Driver = NetworkDriverBridge
+	}
+	switch netOptions.Driver {
+	case NetworkDriverBridge:
+		if opts.Parent != "" {
+			return nil, fmt.Errorf("parent interface is only valid for %s and %s networks", NetworkDriverMacvlan, NetworkDriverIPvlan)
+		}
+	case NetworkDriverMacvlan, NetworkDriverIPvlan:
+		netOptions.NetworkInterface = opts.Parent
+		if opts.DNSEnabled {
+			return nil, fmt.Errorf("DNS is only supported on %s networks", NetworkDriverBridge)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported network driver %q", opts.Driver)
+	}
+	netOptions.Internal = opts.Internal
+	netOptions.DNSEnabled = opts.DNSEnabled
+	netOptions.Labels = opts.Labels
+
+	for _, spec := range opts.Subnets {
+		subnet, err := parseSubnet(spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range netOptions.Subnets {
+			if existing.Subnet.Contains(subnet.Subnet.IP) || subnet.Subnet.Contains(existing.Subnet.IP) {
+				return nil, fmt.Errorf("subnets %s and %s overlap", existing.Subnet.String(), subnet.Subnet.String())
+			}
+		}
+		if subnet.Subnet.IP.To4() == nil {
+			netOptions.IPv6Enabled = true
+		}
+		netOptions.Subnets = append(netOptions.Subnets, subnet)
+	}
+	return netOptions, nil
+}
+
+// parseSubnet validates a subnet given in CIDR notation along with its
+// optional gateway and IP range.
+func parseSubnet(spec NetworkSubnet) (types.Subnet, error) {
+	ip, ipNet, err := net.ParseCIDR(spec.Subnet)
+	if err != nil {
+		return types.Subnet{}, fmt.Errorf("invalid subnet %q: %v", spec.Subnet, err)
+	}
+	if !ip.Equal(ipNet.IP) {
+		return types.Subnet{}, fmt.Errorf("subnet %q has host bits set, did you mean %s?", spec.Subnet, ipNet.String())
+	}
+	subnet := types.Subnet{Subnet: types.IPNet{IPNet: *ipNet}}
+
+	parseAddr := func(field, value string) (net.IP, error) {
+		addr := net.ParseIP(value)
+		if addr == nil {
+			return nil, fmt.Errorf("invalid %s %q", field, value)
+		}
+		if !ipNet.Contains(addr) {
+			return nil, fmt.Errorf("%s %s is not in subnet %s", field, value, ipNet.String())
+		}
+		return addr, nil
+	}
+	if spec.Gateway != "" {
+		if subnet.Gateway, err = parseAddr("gateway", spec.Gateway); err != nil {
+			return types.Subnet{}, err
+		}
+		if subnet.Gateway.Equal(ipNet.IP) {
+			return types.Subnet{}, fmt.Errorf("gateway %s is the network address of %s", spec.Gateway, ipNet.String())
+		}
+	}
+	if spec.RangeStart != "" || spec.RangeEnd != "" {
+		subnet.LeaseRange = new(types.LeaseRange)
+		if spec.RangeStart != "" {
+			if subnet.LeaseRange.StartIP, err = parseAddr("range start", spec.RangeStart); err != nil {
+				return types.Subnet{}, err
+			}
+		}
+		if spec.RangeEnd != "" {
+			if subnet.LeaseRange.EndIP, err = parseAddr("range end", spec.RangeEnd); err != nil {
+				return types.Subnet{}, err
+			}
+		}
+		start, end := subnet.LeaseRange.StartIP, subnet.LeaseRange.EndIP
+		if start != nil && end != nil && bytes.Compare(start.To16(), end.To16()) > 0 {
+			return types.Subnet{}, fmt.Errorf("range start %s is after range end %s", start, end)
+		}
+	}
+	return subnet, nil
+}
+
+// ValidateNetworkCreateOptions checks opts without creating anything.
+func ValidateNetworkCreateOptions(opts NetworkCreateOptions) error {
+	_, err := buildNetwork(opts)
+	return err
+}
+
+func InitNewNetwork(ctx context.Context, opts NetworkCreateOptions) error {
+	netOptions, err := buildNetwork(opts)
+	if err != nil {
+		return err
+	}
 	// The network.Create function returns a response containing details about the created network.
 	netResponse, err := network.Create(ctx, netOptions)
 	if err != nil {
@@ -44,22 +169,150 @@ func RemoveNetwork(ctx context.Context, name string) error {
 }
 
 func ListNetworks(ctx context.Context) ([]types.Network, error) {
-	networks, err := network.List(ctx, nil)
+	networks, err := networkList(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error listing networks: %v", err)
 	}
 	return networks, nil
 }
 
-// returns IP address of the container after attaching it to the network
-func AttachContainerToNetwork(ctx context.Context, containerID, networkName string) (string, error) {
-	err := network.Connect(ctx, containerID, networkName, nil)
+// AttachOptions are optional per network settings for a container.
+type AttachOptions struct {
+	StaticIPs []net.IP
+	StaticMAC net.HardwareAddr
+	Aliases   []string
+}
+
+// returns IP address of the container on the network after attaching it
+func AttachContainerToNetwork(ctx context.Context, containerID, networkName string, opts AttachOptions) (string, error) {
+	if err := checkAliasesResolvable(ctx, networkName, opts.Aliases); err != nil {
+		return "", err
+	}
+	perNetOpts := &types.PerNetworkOptions{
+		StaticIPs: opts.StaticIPs,
+		StaticMAC: types.HardwareAddr(opts.StaticMAC),
+		Aliases:   opts.Aliases,
+	}
+	err := networkConnect(ctx, networkName, containerID, perNetOpts)
 	if err != nil {
 		return "", fmt.Errorf("error attaching container to network: %v", err)
 	}
-	ipAddr, err := GetIPAddress(ctx, containerID)
+	ipAddr, err := GetNetworkIPAddress(ctx, containerID, networkName)
 	if err != nil {
 		return "", fmt.Errorf("error inspecting network: %v", err)
 	}
 	return ipAddr, nil
 }
+
+func DetachContainerFromNetwork(ctx context.Context, containerID, networkName string, force bool) error {
+	err := networkDisconnect(ctx, networkName, containerID, &network.DisconnectOptions{Force: utils.GetPtr(force)})
+	if err != nil {
+		return fmt.Errorf("error detaching container from network: %v", err)
+	}
+	return nil
+}
+
+// GetNetworkIPAddress returns the IP address of a container on a specific network
+func GetNetworkIPAddress(ctx context.Context, containerID, networkName string) (string, error) {
+	inspectData, err := containersInspect(ctx, containerID, nil)
+	if err != nil {
+		return "", err
+	}
+	if inspectData.NetworkSettings == nil {
+		return "", fmt.Errorf("No network settings found for container")
+	}
+	netData, ok := inspectData.NetworkSettings.Networks[networkName]
+	if !ok {
+		return "", fmt.Errorf("container is not attached to network %s", networkName)
+	}
+	return netData.IPAddress, nil
+}
+
+type NetworkSubnet struct {
+	Subnet     string `json:"subnet"`
+	Gateway    string `json:"gateway,omitempty"`
+	RangeStart string `json:"range_start,omitempty"`
+	RangeEnd   string `json:"range_end,omitempty"`
+}
+
+// NetworkAttachment describes a container attached to a network.
+type NetworkAttachment struct {
+	ID        string   `json:"env_id"`
+	Name      string   `json:"name"`
+	Interface string   `json:"interface"`
+	IPs       []string `json:"ips"`
+	MAC       string   `json:"mac"`
+	// names other containers on the network resolve, empty without DNS
+	DNSNames []string `json:"dns_names"`
+}
+
+// NetworkDetails is the single network view returned by InspectNetwork.
+type NetworkDetails struct {
+	Name       string              `json:"name"`
+	ID         string              `json:"id"`
+	Driver     string              `json:"driver"`
+	Interface  string              `json:"interface"`
+	Subnets    []NetworkSubnet     `json:"subnets"`
+	IPv6       bool                `json:"ipv6"`
+	Internal   bool                `json:"internal"`
+	DNSEnabled bool                `json:"dns_enabled"`
+	Labels     map[string]string   `json:"labels"`
+	Containers []NetworkAttachment `json:"containers"`
+}
+
+func InspectNetwork(ctx context.Context, name string) (NetworkDetails, error) {
+	report, err := networkInspect(ctx, name, nil)
+	if err != nil {
+		return NetworkDetails{}, fmt.Errorf("error inspecting network: %v", err)
+	}
+	details := NetworkDetails{
+		Name:       report.Name,
+		ID:         report.ID,
+		Driver:     report.Driver,
+		Interface:  report.NetworkInterface,
+		Subnets:    []NetworkSubnet{},
+		IPv6:       report.IPv6Enabled,
+		Internal:   report.Internal,
+		DNSEnabled: report.DNSEnabled,
+		Labels:     report.Labels,
+		Containers: []NetworkAttachment{},
+	}
+	for _, subnet := range report.Subnets {
+		ns := NetworkSubnet{Subnet: subnet.Subnet.String()}
+		if subnet.Gateway != nil {
+			ns.Gateway = subnet.Gateway.String()
+		}
+		if subnet.LeaseRange != nil {
+			if subnet.LeaseRange.StartIP != nil {
+				ns.RangeStart = subnet.LeaseRange.StartIP.String()
+			}
+			if subnet.LeaseRange.EndIP != nil {
+				ns.RangeEnd = subnet.LeaseRange.EndIP.String()
+			}
+		}
+		details.Subnets = append(details.Subnets, ns)
+	}
+	for id, ctr := range report.Containers {
+		for ifName, iface := range ctr.Interfaces {
+			attachment := NetworkAttachment{
+				ID:        id,
+				Name:      ctr.Name,
+				Interface: ifName,
+				IPs:       []string{},
+				MAC:       iface.MacAddress.String(),
+				DNSNames:  []string{},
+			}
+			if report.DNSEnabled {
+				attachment.DNSNames = attachedDNSNames(ctx, id, ctr.Name, report.Name)
+			}
+			for _, addr := range iface.Subnets {
+				attachment.IPs = append(attachment.IPs, addr.IPNet.IP.String())
+			}
+			details.Containers = append(details.Containers, attachment)
+		}
+	}
+	sort.Slice(details.Containers, func(i, j int) bool {
+		return details.Containers[i].Name < details.Containers[j].Name
+	})
+	return details, nil
+}
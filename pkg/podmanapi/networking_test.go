@@ -0,0 +1,146 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/bindings/network"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+)
+
+func TestAttachContainerToNetwork_PassesOptions(t *testing.T) {
+	origConnect := networkConnect
+	origInspect := containersInspect
+	origNetInspect := networkInspect
+	defer func() {
+		networkConnect = origConnect
+		containersInspect = origInspect
+		networkInspect = origNetInspect
+	}()
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		report := entitiesTypes.NetworkInspectReport{}
+		report.DNSEnabled = nameOrID == "labnet"
+		return report, nil
+	}
+
+	var gotNetwork, gotContainer string
+	var gotOpts *types.PerNetworkOptions
+	networkConnect = func(ctx context.Context, networkName string, containerNameOrID string, options *types.PerNetworkOptions) error {
+		gotNetwork, gotContainer, gotOpts = networkName, containerNameOrID, options
+		return nil
+	}
+	containersInspect = func(ctx context.Context, containerID string, options *containers.InspectOptions) (*define.InspectContainerData, error) {
+		data := new(define.InspectContainerData)
+		data.NetworkSettings = new(define.InspectNetworkSettings)
+		data.NetworkSettings.Networks = map[string]*define.InspectAdditionalNetwork{
+			"labnet": {InspectBasicNetworkConfig: define.InspectBasicNetworkConfig{IPAddress: "10.90.0.5"}},
+		}
+		return data, nil
+	}
+
+	mac, _ := net.ParseMAC("02:42:ac:11:00:02")
+	ip, err := AttachContainerToNetwork(context.Background(), "ctr", "labnet", AttachOptions{
+		StaticIPs: []net.IP{net.ParseIP("10.90.0.5")},
+		StaticMAC: mac,
+		Aliases:   []string{"env"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if gotNetwork != "labnet" || gotContainer != "ctr" {
+		t.Errorf("expected network labnet and container ctr, got: %s %s", gotNetwork, gotContainer)
+	}
+	if len(gotOpts.StaticIPs) != 1 || gotOpts.StaticMAC.String() != mac.String() || gotOpts.Aliases[0] != "env" {
+		t.Errorf("options not passed through: %#v", gotOpts)
+	}
+	if ip != "10.90.0.5" {
+		t.Errorf("expected IP on labnet, got: %s", ip)
+	}
+
+	// the default network has no DNS, aliases would do nothing there
+	if _, err := AttachContainerToNetwork(context.Background(), "ctr", "podman", AttachOptions{Aliases: []string{"env"}}); !errors.Is(err, ErrDNSDisabled) {
+		t.Errorf("expected ErrDNSDisabled, got: %v", err)
+	}
+}
+
+func TestInspectNetwork(t *testing.T) {
+	origInspect := networkInspect
+	defer func() { networkInspect = origInspect }()
+
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		_, subnet, _ := net.ParseCIDR("10.90.0.0/24")
+		report := entitiesTypes.NetworkInspectReport{}
+		report.Name = nameOrID
+		report.Driver = "bridge"
+		report.Subnets = []types.Subnet{{Subnet: types.IPNet{IPNet: *subnet}, Gateway: net.ParseIP("10.90.0.1")}}
+		report.Containers = map[string]entitiesTypes.NetworkContainerInfo{
+			"abc": {
+				Name: "env1",
+				Interfaces: map[string]types.NetInterface{
+					"eth0": {Subnets: []types.NetAddress{{IPNet: types.IPNet{IPNet: net.IPNet{IP: net.ParseIP("10.90.0.2"), Mask: subnet.Mask}}}}},
+				},
+			},
+		}
+		return report, nil
+	}
+
+	details, err := InspectNetwork(context.Background(), "labnet")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(details.Subnets) != 1 || details.Subnets[0].Subnet != "10.90.0.0/24" || details.Subnets[0].Gateway != "10.90.0.1" {
+		t.Errorf("unexpected subnets: %#v", details.Subnets)
+	}
+	if len(details.Containers) != 1 || details.Containers[0].Name != "env1" || details.Containers[0].IPs[0] != "10.90.0.2" {
+		t.Errorf("unexpected containers: %#v", details.Containers)
+	}
+}
+
+func TestBuildNetwork(t *testing.T) {
+	netOpts, err := buildNetwork(NetworkCreateOptions{
+		Name: "labnet",
+		Subnets: []NetworkSubnet{
+			{Subnet: "10.90.0.0/24", Gateway: "10.90.0.1", RangeStart: "10.90.0.100", RangeEnd: "10.90.0.200"},
+			{Subnet: "fd00:90::/64", Gateway: "fd00:90::1"},
+		},
+		DNSEnabled: true,
+		Labels:     map[string]string{"owner": "abra"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if netOpts.Driver != NetworkDriverBridge || !netOpts.IPv6Enabled || !netOpts.DNSEnabled {
+		t.Errorf("unexpected network: %#v", netOpts)
+	}
+	if ones, bits := netOpts.Subnets[0].Subnet.Mask.Size(); ones != 24 || bits != 32 {
+		t.Errorf("expected a 4 byte /24 mask, got: /%d of %d bits", ones, bits)
+	}
+	if netOpts.Subnets[0].LeaseRange.StartIP.String() != "10.90.0.100" {
+		t.Errorf("unexpected lease range: %#v", netOpts.Subnets[0].LeaseRange)
+	}
+}
+
+func TestBuildNetwork_Invalid(t *testing.T) {
+	tests := map[string]NetworkCreateOptions{
+		"bad name":          {Name: "-net"},
+		"bad driver":        {Name: "n", Driver: "overlay"},
+		"bad cidr":          {Name: "n", Subnets: []NetworkSubnet{{Subnet: "10.90.0.0"}}},
+		"host bits":         {Name: "n", Subnets: []NetworkSubnet{{Subnet: "10.90.0.5/24"}}},
+		"gateway outside":   {Name: "n", Subnets: []NetworkSubnet{{Subnet: "10.90.0.0/24", Gateway: "10.91.0.1"}}},
+		"gateway network":   {Name: "n", Subnets: []NetworkSubnet{{Subnet: "10.90.0.0/24", Gateway: "10.90.0.0"}}},
+		"range reversed":    {Name: "n", Subnets: []NetworkSubnet{{Subnet: "10.90.0.0/24", RangeStart: "10.90.0.9", RangeEnd: "10.90.0.2"}}},
+		"overlap":           {Name: "n", Subnets: []NetworkSubnet{{Subnet: "10.90.0.0/16"}, {Subnet: "10.90.1.0/24"}}},
+		"macvlan dns":       {Name: "n", Driver: NetworkDriverMacvlan, DNSEnabled: true},
+		"bridge and parent": {Name: "n", Parent: "eth0"},
+	}
+	for name, opts := range tests {
+		if _, err := buildNetwork(opts); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
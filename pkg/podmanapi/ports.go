@@ -0,0 +1,203 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	nettypes "github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/sonarping/go-nodeapi/pkg/utils"
+)
+
+// host ports handed out when a mapping does not name one
+const (
+	autoPortMin = 30000
+	autoPortMax = 39999
+)
+
+// ErrPortUnavailable wraps errors for host ports that are already taken.
+var ErrPortUnavailable = errors.New("host port unavailable")
+
+// Dependency injection variables for testing:
+var (
+	hostPortFreeFunc = hostPortFree
+)
+
+// ports picked for containers that are still being created and therefore
+// do not show up in the container list yet
+var (
+	portMu        sync.Mutex
+	reservedPorts = map[string]PortMapping{}
+)
+
+// PortMapping publishes a container port on the host. A zero HostPort is
+// assigned automatically, an empty HostIP binds all addresses.
+type PortMapping struct {
+	HostIP        string `json:"host_ip,omitempty"`
+	HostPort      uint16 `json:"host_port"`
+	ContainerPort uint16 `json:"container_port"`
+	Protocol      string `json:"protocol"`
+}
+
+func (p PortMapping) key() string {
+	return fmt.Sprintf("%s/%s/%d", p.Protocol, p.HostIP, p.HostPort)
+}
+
+// overlaps reports whether both mappings would bind the same host socket.
+func (p PortMapping) overlaps(other PortMapping) bool {
+	if p.Protocol != other.Protocol || p.HostPort != other.HostPort {
+		return false
+	}
+	return isWildcardIP(p.HostIP) || isWildcardIP(other.HostIP) || p.HostIP == other.HostIP
+}
+
+func isWildcardIP(ip string) bool {
+	return ip == "" || ip == "0.0.0.0" || ip == "::"
+}
+
+// fromPodmanPorts expands podman's port ranges and protocol lists.
+func fromPodmanPorts(ports []nettypes.PortMapping) []PortMapping {
+	mappings := []PortMapping{}
+	for _, p := range ports {
+		count := p.Range
+		if count == 0 {
+			count = 1
+		}
+		protocols := strings.Split(p.Protocol, ",")
+		for _, proto := range protocols {
+			if proto == "" {
+				proto = "tcp"
+			}
+			for i := uint16(0); i < count; i++ {
+				mappings = append(mappings, PortMapping{
+					HostIP:        p.HostIP,
+					HostPort:      p.HostPort + i,
+					ContainerPort: p.ContainerPort + i,
+					Protocol:      proto,
+				})
+			}
+		}
+	}
+	return mappings
+}
+
+func validatePortMapping(p *PortMapping) error {
+	if p.ContainerPort == 0 {
+		return fmt.Errorf("container port is required")
+	}
+	p.Protocol = strings.ToLower(p.Protocol)
+	switch p.Protocol {
+	case "":
+		p.Protocol = "tcp"
+	case "tcp", "udp", "sctp":
+	default:
+		return fmt.Errorf("unsupported protocol %q, expected tcp, udp or sctp", p.Protocol)
+	}
+	if p.HostIP != "" && net.ParseIP(p.HostIP) == nil {
+		return fmt.Errorf("invalid host IP %q", p.HostIP)
+	}
+	return nil
+}
+
+// reservePorts validates the requested mappings, assigns missing host ports
+// and checks them against other containers and sockets open on the host.
+// The returned func drops the reservation once the container exists.
+func reservePorts(ctx context.Context, requested []PortMapping) ([]nettypes.PortMapping, func(), error) {
+	if len(requested) == 0 {
+		return nil, func() {}, nil
+	}
+	ctrList, err := containersList(ctx, &containers.ListOptions{All: utils.GetPtr(true)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing containers: %v", err)
+	}
+	var inUse []PortMapping
+	for _, ctr := range ctrList {
+		inUse = append(inUse, fromPodmanPorts(ctr.Ports)...)
+	}
+
+	portMu.Lock()
+	defer portMu.Unlock()
+	taken := func(p PortMapping) bool {
+		for _, used := range inUse {
+			if p.overlaps(used) {
+				return true
+			}
+		}
+		for _, reserved := range reservedPorts {
+			if p.overlaps(reserved) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var picked []PortMapping
+	for _, p := range requested {
+		if err := validatePortMapping(&p); err != nil {
+			return nil, nil, err
+		}
+		if p.HostPort == 0 {
+			for port := autoPortMin; port <= autoPortMax; port++ {
+				p.HostPort = uint16(port)
+				if !taken(p) && hostPortFreeFunc(p) == nil {
+					break
+				}
+				p.HostPort = 0
+			}
+			if p.HostPort == 0 {
+				return nil, nil, fmt.Errorf("%w: no free %s port between %d and %d", ErrPortUnavailable, p.Protocol, autoPortMin, autoPortMax)
+			}
+		} else if taken(p) {
+			return nil, nil, fmt.Errorf("%w: %s port %d is already published by another container", ErrPortUnavailable, p.Protocol, p.HostPort)
+		} else if err := hostPortFreeFunc(p); err != nil {
+			return nil, nil, fmt.Errorf("%w: %s port %d is in use on the host: %v", ErrPortUnavailable, p.Protocol, p.HostPort, err)
+		}
+		inUse = append(inUse, p)
+		picked = append(picked, p)
+	}
+
+	specPorts := make([]nettypes.PortMapping, 0, len(picked))
+	for _, p := range picked {
+		reservedPorts[p.key()] = p
+		specPorts = append(specPorts, nettypes.PortMapping{
+			HostIP:        p.HostIP,
+			HostPort:      p.HostPort,
+			ContainerPort: p.ContainerPort,
+			Protocol:      p.Protocol,
+		})
+	}
+	release := func() {
+		portMu.Lock()
+		defer portMu.Unlock()
+		for _, p := range picked {
+			delete(reservedPorts, p.key())
+		}
+	}
+	return specPorts, release, nil
+}
+
+// hostPortFree tries to bind the port to find sockets not owned by podman.
+func hostPortFree(p PortMapping) error {
+	addr := net.JoinHostPort(p.HostIP, strconv.Itoa(int(p.HostPort)))
+	switch p.Protocol {
+	case "tcp":
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		return l.Close()
+	case "udp":
+		l, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+		return l.Close()
+	}
+	// sctp cannot be probed with the standard library
+	return nil
+}
@@ -0,0 +1,65 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	nettypes "github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
+)
+
+func TestReservePorts(t *testing.T) {
+	origList := containersList
+	origFree := hostPortFreeFunc
+	defer func() {
+		containersList = origList
+		hostPortFreeFunc = origFree
+		reservedPorts = map[string]PortMapping{}
+	}()
+
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]types.ListContainer, error) {
+		return []types.ListContainer{{
+			Names: []string{"env1"},
+			Ports: []nettypes.PortMapping{{HostPort: autoPortMin, ContainerPort: 80, Range: 2, Protocol: "tcp"}},
+		}}, nil
+	}
+	hostPortFreeFunc = func(p PortMapping) error {
+		if p.HostPort == autoPortMin+2 {
+			return fmt.Errorf("address already in use")
+		}
+		return nil
+	}
+
+	ports, release, err := reservePorts(context.Background(), []PortMapping{
+		{ContainerPort: 5801},
+		{HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 7681, Protocol: "TCP"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// 30000-30001 are published by env1 and 30002 is taken on the host
+	if ports[0].HostPort != autoPortMin+3 || ports[0].Protocol != "tcp" {
+		t.Errorf("expected auto-assigned tcp port %d, got: %#v", autoPortMin+3, ports[0])
+	}
+	if ports[1].HostIP != "127.0.0.1" || ports[1].HostPort != 8080 || ports[1].Protocol != "tcp" {
+		t.Errorf("unexpected mapping: %#v", ports[1])
+	}
+
+	// reserved ports stay taken until the container shows up in the list
+	if _, _, err := reservePorts(context.Background(), []PortMapping{{HostPort: 8080, ContainerPort: 80}}); !errors.Is(err, ErrPortUnavailable) {
+		t.Errorf("expected reserved port conflict, got: %v", err)
+	}
+	release()
+	if _, _, err := reservePorts(context.Background(), []PortMapping{{HostPort: autoPortMin + 1, ContainerPort: 80}}); !errors.Is(err, ErrPortUnavailable) {
+		t.Errorf("expected conflict with published range, got: %v", err)
+	}
+	if _, _, err := reservePorts(context.Background(), []PortMapping{{HostPort: autoPortMin + 1, ContainerPort: 80, Protocol: "udp"}}); err != nil {
+		t.Errorf("expected udp port to be free, got: %v", err)
+	}
+	if _, _, err := reservePorts(context.Background(), []PortMapping{{HostPort: 9000}}); err == nil {
+		t.Errorf("expected missing container port to be rejected")
+	}
+}
@@ -0,0 +1,211 @@
+package podmanapi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultEBPFImage = "base_ebpf:latest"
+	// CAP_BPF is the highest capability the eBPF containers need (kernel 5.8)
+	capBPF = 39
+)
+
+// ErrEBPFNotReady is returned when eBPF environments cannot be created on
+// this node because prerequisites are missing.
+var ErrEBPFNotReady = errors.New("node is not ready for eBPF environments")
+
+// host paths are resolved below sysRoot, for testing
+var sysRoot = "/"
+
+// PreflightCheck is the result of one eBPF prerequisite check. Checks that
+// are not required only limit what programs can do.
+type PreflightCheck struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Required bool   `json:"required"`
+	Detail   string `json:"detail"`
+}
+
+// EBPFPreflight reports whether this node can run eBPF environments.
+type EBPFPreflight struct {
+	Kernel string           `json:"kernel"`
+	Ready  bool             `json:"ready"`
+	Checks []PreflightCheck `json:"checks"`
+}
+
+// Err returns an ErrEBPFNotReady error naming the failed required checks,
+// or nil when the node is ready.
+func (p EBPFPreflight) Err() error {
+	failed := []string{}
+	for _, c := range p.Checks {
+		if c.Required && !c.OK {
+			failed = append(failed, fmt.Sprintf("%s: %s", c.Name, c.Detail))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrEBPFNotReady, strings.Join(failed, "; "))
+}
+
+func hostPath(p string) string {
+	return filepath.Join(sysRoot, p)
+}
+
+func pathCheck(name string, p string, required bool, missing string) PreflightCheck {
+	check := PreflightCheck{Name: name, Required: required}
+	if _, err := os.Stat(hostPath(p)); err == nil {
+		check.OK = true
+		check.Detail = p
+	} else {
+		check.Detail = fmt.Sprintf("%s not found, %s", p, missing)
+	}
+	return check
+}
+
+// kernelRelease returns the running kernel's release, as uname -r does.
+func kernelRelease() (string, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "sys/kernel/osrelease"))
+	if err != nil {
+		return "", fmt.Errorf("failed to get kernel version: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// bpffsMounted looks for a bpf filesystem at /sys/fs/bpf in the mount table.
+func bpffsMounted() bool {
+	f, err := os.Open(filepath.Join(procRoot, "self/mounts"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[1] == bpffsRoot && fields[2] == "bpf" {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilityBits numbers the capabilities eBPF containers may get, see
+// capabilities(7)
+var capabilityBits = map[string]uint{
+	"CAP_NET_ADMIN": 12,
+	"CAP_PERFMON":   38,
+	"CAP_BPF":       39,
+}
+
+// missingCapabilities returns the capabilities eBPF containers get that are
+// not in the API's own effective set, as a container can only get those.
+func missingCapabilities() ([]string, error) {
+	f, err := os.Open(filepath.Join(procRoot, "self/status"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the effective capabilities: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !ok {
+			continue
+		}
+		effective, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the effective capabilities: %v", err)
+		}
+		missing := []string{}
+		for _, c := range ebpfCapabilities {
+			if effective&(1<<capabilityBits[c]) == 0 {
+				missing = append(missing, c)
+			}
+		}
+		return missing, nil
+	}
+	return nil, fmt.Errorf("no effective capabilities in %s", f.Name())
+}
+
+// CheckEBPFPreflight checks the kernel features, host files and image eBPF
+// environments created from image with the given mount profile need.
+func CheckEBPFPreflight(ctx context.Context, image string, profile string) EBPFPreflight {
+	if image == "" {
+		image = defaultEBPFImage
+	}
+	preflight := EBPFPreflight{Checks: []PreflightCheck{}}
+
+	kernel, err := kernelRelease()
+	check := PreflightCheck{Name: "kernel", Required: true, OK: err == nil, Detail: kernel}
+	if err != nil {
+		check.Detail = err.Error()
+	}
+	preflight.Kernel = kernel
+	preflight.Checks = append(preflight.Checks, check)
+
+	if kernel != "" {
+		preflight.Checks = append(preflight.Checks,
+			pathCheck("kernel_headers", "/usr/src/kernels/"+kernel, false, "install the kernel-devel package for the running kernel"),
+			pathCheck("kernel_modules", "/lib/modules/"+kernel, false, "install the kernel modules for the running kernel"),
+		)
+	}
+
+	// the mounts of the profile decide which host files are required
+	check = PreflightCheck{Name: "mount_profile", Required: true, Detail: profile}
+	if _, err := profileMounts(profile, kernel); err != nil {
+		check.Detail = err.Error()
+	} else {
+		check.OK = true
+		if profile == "" {
+			check.Detail = "default"
+		}
+	}
+	preflight.Checks = append(preflight.Checks, check)
+	preflight.Checks = append(preflight.Checks,
+		pathCheck("btf", "/sys/kernel/btf/vmlinux", false, "CO-RE programs will not load"),
+		pathCheck("cgroup_v2", "/sys/fs/cgroup/cgroup.controllers", true, "the unified cgroup hierarchy is required"),
+	)
+
+	check = PreflightCheck{Name: "bpffs", OK: bpffsMounted(), Detail: bpffsRoot}
+	if !check.OK {
+		check.Detail = fmt.Sprintf("no bpf filesystem mounted at %s, objects cannot be pinned", bpffsRoot)
+	}
+	preflight.Checks = append(preflight.Checks, check)
+
+	check = PreflightCheck{Name: "capabilities", Required: true}
+	data, err := os.ReadFile(filepath.Join(procRoot, "sys/kernel/cap_last_cap"))
+	if err != nil {
+		check.Detail = fmt.Sprintf("failed to read the last capability: %v", err)
+	} else if last, err := strconv.Atoi(strings.TrimSpace(string(data))); err != nil || last < capBPF {
+		check.Detail = "the kernel does not support CAP_BPF and CAP_PERFMON"
+	} else if missing, err := missingCapabilities(); err != nil {
+		check.Detail = err.Error()
+	} else if len(missing) > 0 {
+		check.Detail = fmt.Sprintf("the API cannot grant %s, it is not running with them", strings.Join(missing, ", "))
+	} else {
+		check.OK = true
+		check.Detail = strings.Join(ebpfCapabilities, ", ")
+	}
+	preflight.Checks = append(preflight.Checks, check)
+
+	check = PreflightCheck{Name: "image", Required: true, Detail: image}
+	exists, err := imagesExists(ctx, image, nil)
+	switch {
+	case err != nil:
+		check.Detail = fmt.Sprintf("error checking image %s: %v", image, err)
+	case !exists:
+		check.Detail = fmt.Sprintf("image %s not found", image)
+	default:
+		check.OK = true
+	}
+	preflight.Checks = append(preflight.Checks, check)
+
+	preflight.Ready = preflight.Err() == nil
+	return preflight
+}
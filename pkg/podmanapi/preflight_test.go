@@ -0,0 +1,78 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/podman/v5/pkg/bindings/images"
+	"github.com/sonarping/go-nodeapi/pkg/config"
+)
+
+func TestCheckEBPFPreflight(t *testing.T) {
+	origSys, origProc, origExists, origConfig := sysRoot, procRoot, imagesExists, ebpfConfig
+	defer func() {
+		sysRoot, procRoot, imagesExists, ebpfConfig = origSys, origProc, origExists, origConfig
+	}()
+	ebpfConfig = func() (config.EBPFConfig, error) { return config.EBPFConfig{}, nil }
+	sysRoot = t.TempDir()
+	procRoot = t.TempDir()
+
+	write := func(root string, name string, data string) {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(root, name), []byte(data), 0644)
+	}
+	write(procRoot, "sys/kernel/osrelease", "6.8.0-test\n")
+	write(procRoot, "sys/kernel/cap_last_cap", "40\n")
+	write(procRoot, "self/mounts", "bpf /sys/fs/bpf bpf rw,relatime 0 0\n")
+	write(procRoot, "self/status", "Name:\tnodeapi\nCapEff:\t000001ffffffffff\n")
+	write(sysRoot, "lib/modules/6.8.0-test/modules.dep", "")
+	write(sysRoot, "sys/fs/cgroup/cgroup.controllers", "cpu memory")
+	imagesExists = func(ctx context.Context, name string, _ *images.ExistsOptions) (bool, error) {
+		return name == defaultEBPFImage, nil
+	}
+
+	// the default networking profile mounts the kernel headers
+	preflight := CheckEBPFPreflight(context.Background(), "", "")
+	if preflight.Kernel != "6.8.0-test" || preflight.Ready {
+		t.Fatalf("expected missing headers to fail the preflight, got: %#v", preflight)
+	}
+	if err := preflight.Err(); !errors.Is(err, ErrEBPFNotReady) {
+		t.Errorf("expected ErrEBPFNotReady, got: %v", err)
+	}
+	for _, c := range preflight.Checks {
+		if c.OK != (c.Name != "kernel_headers" && c.Name != "btf" && c.Name != "mount_profile") {
+			t.Errorf("unexpected result for %s: %#v", c.Name, c)
+		}
+	}
+	if preflight := CheckEBPFPreflight(context.Background(), "", "minimal"); !preflight.Ready {
+		t.Errorf("expected the minimal profile not to need headers, got: %#v", preflight.Checks)
+	}
+
+	write(sysRoot, "usr/src/kernels/6.8.0-test/Makefile", "")
+	if preflight := CheckEBPFPreflight(context.Background(), "", ""); !preflight.Ready {
+		t.Errorf("expected node to be ready without BTF, got: %#v", preflight.Checks)
+	}
+	if preflight := CheckEBPFPreflight(context.Background(), "", "tracing"); preflight.Ready {
+		t.Errorf("expected tracing to need the host's tracefs and debugfs")
+	}
+	if preflight := CheckEBPFPreflight(context.Background(), "other:latest", ""); preflight.Ready {
+		t.Errorf("expected missing image to fail the preflight")
+	}
+
+	// CAP_SYS_ADMIN is never handed to eBPF containers
+	write(procRoot, "self/status", "Name:\tnodeapi\nCapEff:\t000001ffffdfffff\n")
+	if preflight := CheckEBPFPreflight(context.Background(), "", ""); !preflight.Ready {
+		t.Errorf("expected the API not to need CAP_SYS_ADMIN, got: %#v", preflight.Checks)
+	}
+
+	// running without CAP_BPF and CAP_PERFMON
+	write(procRoot, "self/status", "Name:\tnodeapi\nCapEff:\t0000003fffffffff\n")
+	preflight = CheckEBPFPreflight(context.Background(), "", "")
+	if err := preflight.Err(); err == nil || !strings.Contains(err.Error(), "CAP_BPF, CAP_PERFMON") {
+		t.Errorf("expected missing capabilities to fail the preflight, got: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package podmanapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/bindings/images"
+	"github.com/containers/podman/v5/pkg/bindings/volumes"
+	"github.com/containers/podman/v5/pkg/domain/entities/reports"
+	"github.com/sonarping/go-nodeapi/pkg/utils"
+)
+
+// Dependency injection variables for testing:
+var (
+	imagesList      = images.List
+	imagesPrune     = images.Prune
+	containersPrune = containers.Prune
+	volumesList     = volumes.List
+	volumesPrune    = volumes.Prune
+)
+
+// label no image carries, selecting no images when only the build cache is pruned
+const buildCacheOnlyLabel = "io.abra.prune.build-cache-only"
+
+// PruneOptions selects what to prune. Until and Labels are passed to podman
+// as the "until" and "label" filters for every resource type.
+type PruneOptions struct {
+	Images     bool     `json:"images"`
+	AllImages  bool     `json:"all_images"`
+	BuildCache bool     `json:"build_cache"`
+	Containers bool     `json:"containers"`
+	Volumes    bool     `json:"volumes"`
+	Until      string   `json:"until"`
+	Labels     []string `json:"labels"`
+	DryRun     bool     `json:"dry_run"`
+}
+
+type PrunedItem struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Size uint64 `json:"size"`
+}
+
+// PruneReport lists what was (or with DryRun, would be) removed.
+type PruneReport struct {
+	DryRun         bool         `json:"dry_run"`
+	Containers     []PrunedItem `json:"containers"`
+	Volumes        []PrunedItem `json:"volumes"`
+	Images         []PrunedItem `json:"images"`
+	ReclaimedBytes uint64       `json:"reclaimed_bytes"`
+}
+
+func (o PruneOptions) filters() map[string][]string {
+	filters := map[string][]string{}
+	if o.Until != "" {
+		filters["until"] = []string{o.Until}
+	}
+	if len(o.Labels) > 0 {
+		filters["label"] = o.Labels
+	}
+	return filters
+}
+
+// Prune removes stopped containers, unused volumes and dangling (or with
+// AllImages, unused) images. Containers go first so the images they held
+// become prunable in the same pass.
+func Prune(ctx context.Context, opts PruneOptions) (PruneReport, error) {
+	if opts.DryRun {
+		return pruneCandidates(ctx, opts)
+	}
+	report := PruneReport{
+		Containers: []PrunedItem{},
+		Volumes:    []PrunedItem{},
+		Images:     []PrunedItem{},
+	}
+	if opts.Containers {
+		pruned, err := containersPrune(ctx, &containers.PruneOptions{Filters: opts.filters()})
+		if err != nil {
+			return report, fmt.Errorf("error pruning containers: %v", err)
+		}
+		report.Containers = collectPruned(pruned, &report.ReclaimedBytes)
+	}
+	if opts.Volumes {
+		pruned, err := volumesPrune(ctx, &volumes.PruneOptions{Filters: opts.filters()})
+		if err != nil {
+			return report, fmt.Errorf("error pruning volumes: %v", err)
+		}
+		report.Volumes = collectPruned(pruned, &report.ReclaimedBytes)
+	}
+	if opts.Images || opts.AllImages || opts.BuildCache {
+		imageOpts := new(images.PruneOptions)
+		imageOpts.All = utils.GetPtr(opts.AllImages)
+		imageOpts.BuildCache = utils.GetPtr(opts.BuildCache)
+		imageOpts.Filters = opts.filters()
+		if !opts.Images && !opts.AllImages {
+			// podman always prunes dangling images with the build cache, a
+			// label no image has leaves them alone
+			imageOpts.Filters = withFilter(imageOpts.Filters, "label", buildCacheOnlyLabel)
+		}
+		pruned, err := imagesPrune(ctx, imageOpts)
+		if err != nil {
+			return report, fmt.Errorf("error pruning images: %v", err)
+		}
+		report.Images = collectPruned(pruned, &report.ReclaimedBytes)
+	}
+	return report, nil
+}
+
+func collectPruned(pruned []*reports.PruneReport, reclaimed *uint64) []PrunedItem {
+	items := []PrunedItem{}
+	for _, p := range pruned {
+		if p.Err != nil {
+			log.Printf("Error pruning %s: %v", p.Id, p.Err)
+			continue
+		}
+		items = append(items, PrunedItem{ID: p.Id, Size: p.Size})
+		*reclaimed += p.Size
+	}
+	return items
+}
+
+// pruneCandidates lists what Prune would remove without removing anything.
+func pruneCandidates(ctx context.Context, opts PruneOptions) (PruneReport, error) {
+	report := PruneReport{
+		DryRun:     true,
+		Containers: []PrunedItem{},
+		Volumes:    []PrunedItem{},
+		Images:     []PrunedItem{},
+	}
+
+	allContainers, err := containersList(ctx, &containers.ListOptions{All: utils.GetPtr(true), Size: utils.GetPtr(true)})
+	if err != nil {
+		return report, fmt.Errorf("error listing containers: %v", err)
+	}
+	// images stay in use through any container that is not going to be pruned
+	usedImages := map[string]bool{}
+	if opts.Containers {
+		stopped, err := containersList(ctx, &containers.ListOptions{
+			All:     utils.GetPtr(true),
+			Size:    utils.GetPtr(true),
+			Filters: withFilter(opts.filters(), "status", "created", "exited", "stopped"),
+		})
+		if err != nil {
+			return report, fmt.Errorf("error listing containers: %v", err)
+		}
+		pruned := map[string]bool{}
+		for _, ctr := range stopped {
+			pruned[ctr.ID] = true
+			item := PrunedItem{ID: ctr.ID}
+			if len(ctr.Names) > 0 {
+				item.Name = ctr.Names[0]
+			}
+			if ctr.Size != nil {
+				item.Size = uint64(ctr.Size.RwSize)
+			}
+			report.Containers = append(report.Containers, item)
+			report.ReclaimedBytes += item.Size
+		}
+		for _, ctr := range allContainers {
+			if !pruned[ctr.ID] {
+				usedImages[ctr.ImageID] = true
+			}
+		}
+	} else {
+		for _, ctr := range allContainers {
+			usedImages[ctr.ImageID] = true
+		}
+	}
+
+	if opts.Volumes {
+		unused, err := volumesList(ctx, &volumes.ListOptions{Filters: withFilter(opts.filters(), "dangling", "true")})
+		if err != nil {
+			return report, fmt.Errorf("error listing volumes: %v", err)
+		}
+		for _, vol := range unused {
+			// volume listings carry no size, it is only known after removal
+			report.Volumes = append(report.Volumes, PrunedItem{ID: vol.Name, Name: vol.Name})
+		}
+	}
+
+	if opts.Images || opts.AllImages {
+		filters := opts.filters()
+		if !opts.AllImages {
+			filters = withFilter(filters, "dangling", "true")
+		}
+		candidates, err := imagesList(ctx, &images.ListOptions{All: utils.GetPtr(true), Filters: filters})
+		if err != nil {
+			return report, fmt.Errorf("error listing images: %v", err)
+		}
+		// layers shared with other images are not freed, only count the
+		// unique size as podman system df does
+		usage, err := systemDiskUsage(ctx, nil)
+		if err != nil {
+			return report, fmt.Errorf("error getting disk usage: %v", err)
+		}
+		uniqueSizes := map[string]int64{}
+		for _, img := range usage.Images {
+			uniqueSizes[img.ImageID] = img.UniqueSize
+		}
+		for _, img := range candidates {
+			if usedImages[img.ID] {
+				continue
+			}
+			item := PrunedItem{ID: img.ID, Size: uint64(img.Size)}
+			if unique, ok := uniqueSizes[img.ID]; ok {
+				item.Size = uint64(unique)
+			}
+			if len(img.RepoTags) > 0 {
+				item.Name = img.RepoTags[0]
+			}
+			report.Images = append(report.Images, item)
+			report.ReclaimedBytes += item.Size
+		}
+	}
+	return report, nil
+}
+
+// withFilter returns a copy of filters with key set to values.
+func withFilter(filters map[string][]string, key string, values ...string) map[string][]string {
+	ret := make(map[string][]string, len(filters)+1)
+	for k, v := range filters {
+		ret[k] = v
+	}
+	ret[key] = values
+	return ret
+}
+
+// StartPruneScheduler runs Prune every interval until ctx is cancelled.
+func StartPruneScheduler(ctx context.Context, interval time.Duration, opts PruneOptions) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := Prune(ctx, opts)
+				if err != nil {
+					log.Printf("Scheduled prune failed: %v", err)
+					continue
+				}
+				log.Printf("Scheduled prune removed %d containers, %d volumes, %d images, reclaimed %d bytes",
+					len(report.Containers), len(report.Volumes), len(report.Images), report.ReclaimedBytes)
+			}
+		}
+	}()
+}
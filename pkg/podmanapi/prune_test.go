@@ -0,0 +1,110 @@
+package podmanapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/bindings/images"
+	"github.com/containers/podman/v5/pkg/bindings/system"
+	"github.com/containers/podman/v5/pkg/bindings/volumes"
+	"github.com/containers/podman/v5/pkg/domain/entities/reports"
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
+	psdefine "github.com/containers/podman/v5/pkg/ps/define"
+)
+
+func TestPrune_DryRun(t *testing.T) {
+	origContainersList := containersList
+	origImagesList := imagesList
+	origVolumesList := volumesList
+	origDiskUsage := systemDiskUsage
+	defer func() {
+		containersList = origContainersList
+		imagesList = origImagesList
+		volumesList = origVolumesList
+		systemDiskUsage = origDiskUsage
+	}()
+
+	containersList = func(ctx context.Context, options *containers.ListOptions) ([]types.ListContainer, error) {
+		stopped := types.ListContainer{ID: "stopped", Names: []string{"old-env"}, ImageID: "img-old", Size: &psdefine.ContainerSize{RwSize: 100}}
+		if options.Filters["status"] != nil {
+			return []types.ListContainer{stopped}, nil
+		}
+		return []types.ListContainer{stopped, {ID: "running", ImageID: "img-used"}}, nil
+	}
+	imagesList = func(ctx context.Context, options *images.ListOptions) ([]*types.ImageSummary, error) {
+		if options.Filters["dangling"] != nil {
+			t.Errorf("expected no dangling filter with all_images")
+		}
+		if options.Filters["until"][0] != "24h" {
+			t.Errorf("expected until filter, got: %v", options.Filters)
+		}
+		return []*types.ImageSummary{
+			{ID: "img-old", RepoTags: []string{"lab:old"}, Size: 1000},
+			{ID: "img-used", Size: 5000},
+		}, nil
+	}
+	volumesList = func(ctx context.Context, options *volumes.ListOptions) ([]*types.VolumeListReport, error) {
+		vol := new(types.VolumeListReport)
+		vol.Name = "orphan"
+		return []*types.VolumeListReport{vol}, nil
+	}
+	// 400 bytes of img-old are layers shared with img-used
+	systemDiskUsage = func(ctx context.Context, _ *system.DiskOptions) (*types.SystemDfReport, error) {
+		return &types.SystemDfReport{Images: []*types.SystemDfImageReport{
+			{ImageID: "img-old", Size: 1000, SharedSize: 400, UniqueSize: 600},
+			{ImageID: "img-used", Size: 5000, SharedSize: 400, UniqueSize: 4600, Containers: 1},
+		}}, nil
+	}
+
+	report, err := Prune(context.Background(), PruneOptions{
+		AllImages:  true,
+		Containers: true,
+		Volumes:    true,
+		Until:      "24h",
+		DryRun:     true,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !report.DryRun {
+		t.Errorf("expected dry run report")
+	}
+	if len(report.Containers) != 1 || report.Containers[0].Name != "old-env" {
+		t.Errorf("expected stopped container, got: %#v", report.Containers)
+	}
+	// img-old is only used by the container being pruned, img-used must stay
+	if len(report.Images) != 1 || report.Images[0].ID != "img-old" {
+		t.Errorf("expected only img-old, got: %#v", report.Images)
+	}
+	if len(report.Volumes) != 1 || report.Volumes[0].Name != "orphan" {
+		t.Errorf("expected orphan volume, got: %#v", report.Volumes)
+	}
+	if report.ReclaimedBytes != 700 {
+		t.Errorf("expected 700 reclaimed bytes, got: %d", report.ReclaimedBytes)
+	}
+}
+
+func TestPrune_BuildCacheOnly(t *testing.T) {
+	origPrune := imagesPrune
+	defer func() { imagesPrune = origPrune }()
+	var pruneOpts *images.PruneOptions
+	imagesPrune = func(ctx context.Context, options *images.PruneOptions) ([]*reports.PruneReport, error) {
+		pruneOpts = options
+		return nil, nil
+	}
+
+	if _, err := Prune(context.Background(), PruneOptions{BuildCache: true}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !*pruneOpts.BuildCache || pruneOpts.Filters["label"][0] != buildCacheOnlyLabel {
+		t.Errorf("expected only the build cache to be pruned, got: %#v", pruneOpts)
+	}
+
+	if _, err := Prune(context.Background(), PruneOptions{BuildCache: true, Images: true}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if pruneOpts.Filters["label"] != nil {
+		t.Errorf("expected dangling images to be pruned too, got: %#v", pruneOpts.Filters)
+	}
+}
@@ -0,0 +1,73 @@
+package podmanapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/system"
+)
+
+// Dependency injection variables for testing:
+var (
+	systemDiskUsage = system.DiskUsage
+)
+
+// DiskUsageSummary aggregates the storage used by one kind of podman resource.
+type DiskUsageSummary struct {
+	Total       int   `json:"total"`
+	Active      int   `json:"active"`
+	Size        int64 `json:"size"`
+	Reclaimable int64 `json:"reclaimable"`
+}
+
+// DiskUsage is the equivalent of `podman system df`.
+type DiskUsage struct {
+	Images      DiskUsageSummary `json:"images"`
+	Containers  DiskUsageSummary `json:"containers"`
+	Volumes     DiskUsageSummary `json:"volumes"`
+	Size        int64            `json:"size"`
+	Reclaimable int64            `json:"reclaimable"`
+}
+
+func GetDiskUsage(ctx context.Context) (DiskUsage, error) {
+	report, err := systemDiskUsage(ctx, nil)
+	if err != nil {
+		return DiskUsage{}, fmt.Errorf("error getting disk usage: %v", err)
+	}
+	var usage DiskUsage
+
+	usage.Images.Total = len(report.Images)
+	usage.Images.Size = report.ImagesSize
+	for _, img := range report.Images {
+		if img.Containers > 0 {
+			usage.Images.Active++
+		} else {
+			// shared layers stay referenced by other images, only unique data is freed
+			usage.Images.Reclaimable += img.UniqueSize
+		}
+	}
+
+	usage.Containers.Total = len(report.Containers)
+	for _, ctr := range report.Containers {
+		usage.Containers.Size += ctr.RWSize
+		if ctr.Status == define.ContainerStateRunning.String() {
+			usage.Containers.Active++
+		} else {
+			usage.Containers.Reclaimable += ctr.RWSize
+		}
+	}
+
+	usage.Volumes.Total = len(report.Volumes)
+	for _, vol := range report.Volumes {
+		usage.Volumes.Size += vol.Size
+		usage.Volumes.Reclaimable += vol.ReclaimableSize
+		if vol.Links > 0 {
+			usage.Volumes.Active++
+		}
+	}
+
+	usage.Size = usage.Images.Size + usage.Containers.Size + usage.Volumes.Size
+	usage.Reclaimable = usage.Images.Reclaimable + usage.Containers.Reclaimable + usage.Volumes.Reclaimable
+	return usage, nil
+}
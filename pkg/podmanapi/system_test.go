@@ -0,0 +1,83 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/containers/podman/v5/pkg/bindings/system"
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
+)
+
+func TestGetDiskUsage(t *testing.T) {
+	origDiskUsage := systemDiskUsage
+	defer func() { systemDiskUsage = origDiskUsage }()
+
+	tests := []struct {
+		name     string
+		report   *types.SystemDfReport
+		expected DiskUsage
+	}{
+		{
+			name:     "empty",
+			report:   &types.SystemDfReport{},
+			expected: DiskUsage{},
+		},
+		{
+			name: "images count unique size as reclaimable",
+			report: &types.SystemDfReport{
+				ImagesSize: 1500,
+				Images: []*types.SystemDfImageReport{
+					{ImageID: "used", Size: 1000, SharedSize: 300, UniqueSize: 700, Containers: 2},
+					{ImageID: "unused", Size: 800, SharedSize: 300, UniqueSize: 500},
+				},
+			},
+			expected: DiskUsage{
+				Images:      DiskUsageSummary{Total: 2, Active: 1, Size: 1500, Reclaimable: 500},
+				Size:        1500,
+				Reclaimable: 500,
+			},
+		},
+		{
+			name: "stopped containers and unused volumes",
+			report: &types.SystemDfReport{
+				Containers: []*types.SystemDfContainerReport{
+					{ContainerID: "a", RWSize: 100, Status: "running"},
+					{ContainerID: "b", RWSize: 40, Status: "exited"},
+					{ContainerID: "c", RWSize: 10, Status: "created"},
+				},
+				Volumes: []*types.SystemDfVolumeReport{
+					{VolumeName: "data", Links: 1, Size: 2000},
+					{VolumeName: "orphan", Size: 300, ReclaimableSize: 300},
+				},
+			},
+			expected: DiskUsage{
+				Containers:  DiskUsageSummary{Total: 3, Active: 1, Size: 150, Reclaimable: 50},
+				Volumes:     DiskUsageSummary{Total: 2, Active: 1, Size: 2300, Reclaimable: 300},
+				Size:        2450,
+				Reclaimable: 350,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			systemDiskUsage = func(ctx context.Context, _ *system.DiskOptions) (*types.SystemDfReport, error) {
+				return tt.report, nil
+			}
+			usage, err := GetDiskUsage(context.Background())
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if usage != tt.expected {
+				t.Errorf("expected %+v, got: %+v", tt.expected, usage)
+			}
+		})
+	}
+
+	systemDiskUsage = func(ctx context.Context, _ *system.DiskOptions) (*types.SystemDfReport, error) {
+		return nil, errors.New("podman is down")
+	}
+	if _, err := GetDiskUsage(context.Background()); err == nil {
+		t.Errorf("expected the podman error to be returned")
+	}
+}
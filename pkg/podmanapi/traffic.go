@@ -0,0 +1,193 @@
+package podmanapi
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+)
+
+type TrafficCounters struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+func (t *TrafficCounters) add(o TrafficCounters) {
+	t.RxBytes += o.RxBytes
+	t.RxPackets += o.RxPackets
+	t.RxErrors += o.RxErrors
+	t.RxDropped += o.RxDropped
+	t.TxBytes += o.TxBytes
+	t.TxPackets += o.TxPackets
+	t.TxErrors += o.TxErrors
+	t.TxDropped += o.TxDropped
+}
+
+// InterfaceTraffic are the counters of one interface inside a container.
+type InterfaceTraffic struct {
+	Interface string `json:"interface"`
+	// empty if the interface does not belong to a podman network
+	Network string `json:"network"`
+	TrafficCounters
+}
+
+type ContainerTraffic struct {
+	ID         string             `json:"env_id"`
+	Name       string             `json:"name"`
+	Interfaces []InterfaceTraffic `json:"interfaces"`
+	Total      TrafficCounters    `json:"total"`
+}
+
+type NetworkTraffic struct {
+	Name       string          `json:"name"`
+	Containers int             `json:"containers"`
+	Total      TrafficCounters `json:"total"`
+}
+
+// TrafficStats is a snapshot of the counters of all running containers.
+// Counters are cumulative since the container started.
+type TrafficStats struct {
+	CollectedAt int64              `json:"collected_at"`
+	Containers  []ContainerTraffic `json:"containers"`
+	Networks    []NetworkTraffic   `json:"networks"`
+}
+
+// GetTrafficStats reads the interface counters from each running container's
+// network namespace and sums them up per network.
+func GetTrafficStats(ctx context.Context) (TrafficStats, error) {
+	stats := TrafficStats{
+		CollectedAt: time.Now().Unix(),
+		Containers:  []ContainerTraffic{},
+		Networks:    []NetworkTraffic{},
+	}
+	ctrList, err := containersList(ctx, &containers.ListOptions{
+		Filters: map[string][]string{"status": {"running"}},
+	})
+	if err != nil {
+		return stats, fmt.Errorf("error listing containers: %v", err)
+	}
+
+	// container ID -> interface name -> network name
+	ifaceNetworks := map[string]map[string]string{}
+	inspected := map[string]bool{}
+	for _, ctr := range ctrList {
+		for _, netName := range ctr.Networks {
+			if inspected[netName] {
+				continue
+			}
+			inspected[netName] = true
+			report, err := networkInspect(ctx, netName, nil)
+			if err != nil {
+				// removed since the list, its interfaces stay unattributed
+				log.Printf("Error inspecting network %s: %v", netName, err)
+				continue
+			}
+			for id, info := range report.Containers {
+				if ifaceNetworks[id] == nil {
+					ifaceNetworks[id] = map[string]string{}
+				}
+				for iface := range info.Interfaces {
+					ifaceNetworks[id][iface] = netName
+				}
+			}
+		}
+	}
+
+	perNetwork := map[string]*NetworkTraffic{}
+	for _, ctr := range ctrList {
+		counters, err := readNetDev(ctr.Pid)
+		if err != nil {
+			// the container may have stopped since it was listed
+			continue
+		}
+		ct := ContainerTraffic{ID: ctr.ID, Interfaces: []InterfaceTraffic{}}
+		if len(ctr.Names) > 0 {
+			ct.Name = ctr.Names[0]
+		}
+		seen := map[string]bool{}
+		for _, iface := range sortedKeys(counters) {
+			if iface == "lo" {
+				continue
+			}
+			netName := ifaceNetworks[ctr.ID][iface]
+			ct.Interfaces = append(ct.Interfaces, InterfaceTraffic{Interface: iface, Network: netName, TrafficCounters: counters[iface]})
+			ct.Total.add(counters[iface])
+			if netName == "" {
+				continue
+			}
+			nt, ok := perNetwork[netName]
+			if !ok {
+				nt = &NetworkTraffic{Name: netName}
+				perNetwork[netName] = nt
+			}
+			if !seen[netName] {
+				seen[netName] = true
+				nt.Containers++
+			}
+			nt.Total.add(counters[iface])
+		}
+		stats.Containers = append(stats.Containers, ct)
+	}
+	for _, name := range sortedKeys(perNetwork) {
+		stats.Networks = append(stats.Networks, *perNetwork[name])
+	}
+	return stats, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readNetDev parses /proc/<pid>/net/dev, which lists the interfaces of the
+// network namespace pid lives in.
+func readNetDev(pid int) (map[string]TrafficCounters, error) {
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(pid), "net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	counters := map[string]TrafficCounters{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, values, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			// the two header lines
+			continue
+		}
+		fields := strings.Fields(values)
+		if len(fields) < 16 {
+			continue
+		}
+		v := make([]uint64, 16)
+		for i := range v {
+			v[i], _ = strconv.ParseUint(fields[i], 10, 64)
+		}
+		// receive: bytes packets errs drop fifo frame compressed multicast,
+		// transmit: bytes packets errs drop fifo colls carrier compressed
+		counters[strings.TrimSpace(name)] = TrafficCounters{
+			RxBytes: v[0], RxPackets: v[1], RxErrors: v[2], RxDropped: v[3],
+			TxBytes: v[8], TxPackets: v[9], TxErrors: v[10], TxDropped: v[11],
+		}
+	}
+	return counters, scanner.Err()
+}
@@ -0,0 +1,79 @@
+package podmanapi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/bindings/network"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+)
+
+const testNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     100       1    0    0    0     0          0         0      100       1    0    0    0     0       0          0
+  eth0:    5000      50    1    2    0     0          0         0     3000      30    0    4    0     0       0          0
+`
+
+func TestGetTrafficStats(t *testing.T) {
+	origList := containersList
+	origInspect := networkInspect
+	origProc := procRoot
+	defer func() {
+		containersList = origList
+		networkInspect = origInspect
+		procRoot = origProc
+	}()
+	procRoot = t.TempDir()
+	for _, pid := range []string{"100", "200"} {
+		dir := filepath.Join(procRoot, pid, "net")
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "dev"), []byte(testNetDev), 0644)
+	}
+
+	containersList = func(ctx context.Context, _ *containers.ListOptions) ([]entitiesTypes.ListContainer, error) {
+		return []entitiesTypes.ListContainer{
+			{ID: "a", Names: []string{"env1"}, Pid: 100, Networks: []string{"labnet"}},
+			{ID: "b", Names: []string{"env2"}, Pid: 200, Networks: []string{"labnet"}},
+		}, nil
+	}
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		report := entitiesTypes.NetworkInspectReport{}
+		report.Containers = map[string]entitiesTypes.NetworkContainerInfo{
+			"a": {Interfaces: map[string]types.NetInterface{"eth0": {}}},
+			"b": {Interfaces: map[string]types.NetInterface{"eth0": {}}},
+		}
+		return report, nil
+	}
+
+	stats, err := GetTrafficStats(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(stats.Containers) != 2 || len(stats.Containers[0].Interfaces) != 1 {
+		t.Fatalf("expected 2 containers with eth0 only, got: %#v", stats.Containers)
+	}
+	eth0 := stats.Containers[0].Interfaces[0]
+	if eth0.Network != "labnet" || eth0.RxBytes != 5000 || eth0.RxDropped != 2 || eth0.TxPackets != 30 || eth0.TxDropped != 4 {
+		t.Errorf("unexpected interface counters: %#v", eth0)
+	}
+	if len(stats.Networks) != 1 || stats.Networks[0].Containers != 2 || stats.Networks[0].Total.RxBytes != 10000 {
+		t.Errorf("unexpected network totals: %#v", stats.Networks)
+	}
+
+	// the network was removed between the list and the inspect
+	networkInspect = func(ctx context.Context, nameOrID string, _ *network.InspectOptions) (entitiesTypes.NetworkInspectReport, error) {
+		return entitiesTypes.NetworkInspectReport{}, errors.New("network not found")
+	}
+	stats, err = GetTrafficStats(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(stats.Containers) != 2 || stats.Containers[0].Interfaces[0].Network != "" || len(stats.Networks) != 0 {
+		t.Errorf("expected the interfaces to stay unattributed, got: %#v", stats)
+	}
+}
@@ -0,0 +1,98 @@
+package podmanapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/podman/v5/pkg/bindings/images"
+	"github.com/sonarping/go-nodeapi/pkg/config"
+	"github.com/sonarping/go-nodeapi/pkg/trust"
+	"github.com/sonarping/go-nodeapi/pkg/utils"
+)
+
+// Dependency injection variables for testing:
+var (
+	imagesExists   = images.Exists
+	imagesGetImage = images.GetImage
+	trustPolicy    = currentTrustPolicy
+)
+
+func currentTrustPolicy() (trust.Policy, error) {
+	cfg, err := config.Get()
+	if err != nil {
+		return trust.Policy{}, err
+	}
+	return cfg.Trust, nil
+}
+
+// localImageInfo returns what local storage knows about an image, or nil if
+// the image has not been pulled.
+func localImageInfo(ctx context.Context, imageName string) (*trust.ImageInfo, error) {
+	exists, err := imagesExists(ctx, imageName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error checking image: %v", err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	data, err := imagesGetImage(ctx, imageName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error inspecting image: %v", err)
+	}
+	return &trust.ImageInfo{RepoTags: data.RepoTags, RepoDigests: data.RepoDigests}, nil
+}
+
+// VerifyImage evaluates the node trust policy for an image without acting on it.
+func VerifyImage(ctx context.Context, imageName string) (trust.Decision, error) {
+	policy, err := trustPolicy()
+	if err != nil {
+		return trust.Decision{}, err
+	}
+	local, err := localImageInfo(ctx, imageName)
+	if err != nil {
+		return trust.Decision{}, err
+	}
+	return policy.Evaluate(ctx, imageName, local), nil
+}
+
+// CheckImageTrust returns a *trust.RejectedError if the image may not be used.
+func CheckImageTrust(ctx context.Context, imageName string) error {
+	policy, err := trustPolicy()
+	if err != nil {
+		return err
+	}
+	if !policy.Enabled() {
+		return nil
+	}
+	local, err := localImageInfo(ctx, imageName)
+	if err != nil {
+		return err
+	}
+	return policy.Check(ctx, imageName, local)
+}
+
+// PullImage pulls an image after checking it against the trust policy.
+func PullImage(ctx context.Context, imageName string, creds RegistryCredentials) ([]string, error) {
+	policy, err := trustPolicy()
+	if err != nil {
+		return nil, err
+	}
+	// the pulled image is not local yet, so only the reference itself is checked
+	if err := policy.Check(ctx, imageName, nil); err != nil {
+		return nil, err
+	}
+	pullOpts := new(images.PullOptions)
+	pullOpts.Quiet = utils.GetPtr(true)
+	if creds.Username != "" {
+		pullOpts.Username = utils.GetPtr(creds.Username)
+		pullOpts.Password = utils.GetPtr(creds.Password)
+	}
+	if creds.SkipTLSVerify {
+		pullOpts.SkipTLSVerify = utils.GetPtr(true)
+	}
+	pulled, err := images.Pull(ctx, imageName, pullOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error pulling image: %v", err)
+	}
+	return pulled, nil
+}
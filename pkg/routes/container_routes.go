@@ -31,6 +31,49 @@ func RegisterContainerRoutes(router *gin.Engine) {
 			}
 			c.JSON(http.StatusOK, podmanContainers)
 		})
+		api.GET("/inspect/:id", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			details, err := podmanapi.InspectPodmanContainer(podmanContext, c.Param("id"))
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error inspecting Podman Container: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, details)
+		})
+		// expects a JSON body in the format:
+		// bandwidth: {ingress_kbit, egress_kbit} (0 is unlimited)
+		type UpdateContainerRequest struct {
+			Bandwidth *podmanapi.BandwidthLimits `json:"bandwidth"`
+		}
+		api.POST("/update/:id", func(c *gin.Context) {
+			var req UpdateContainerRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			id := c.Param("id")
+			if req.Bandwidth != nil {
+				if err := podmanapi.SetBandwidthLimits(podmanContext, id, *req.Bandwidth); err != nil {
+					c.String(errorStatus(err), "Error setting bandwidth limits: %v", err)
+					return
+				}
+			}
+			details, err := podmanapi.InspectPodmanContainer(podmanContext, id)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error inspecting Podman Container: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, details)
+		})
 		api.POST("/stop/:id", func(c *gin.Context) {
 			podmanContext, err := podmanapi.InitPodmanConnection()
 			if err != nil {
@@ -136,11 +179,43 @@ func RegisterContainerRoutes(router *gin.Engine) {
 		})
 
 		type CreateContainerRequest struct {
-			Image    string  `json:"image" binding:"required"`
-			Name     string  `json:"name" binding:"required"`
-			IP       string  `json:"ip"`
-			CPUs     float64 `json:"cpus"`
-			MemLimit int64   `json:"mem_limit"`
+			Image     string                    `json:"image" binding:"required"`
+			Name      string                    `json:"name" binding:"required"`
+			IP        string                    `json:"ip"`
+			Network   string                    `json:"network"`
+			Aliases   []string                  `json:"aliases"`
+			Ports     []podmanapi.PortMapping   `json:"ports"`
+			Bandwidth podmanapi.BandwidthLimits `json:"bandwidth"`
+			CPUs      float64                   `json:"cpus"`
+			MemLimit  int64                     `json:"mem_limit"`
+			// create-ebpf only
+			Privileged   bool     `json:"privileged"`
+			Capabilities []string `json:"capabilities"`
+			MountProfile string   `json:"mount_profile"`
+		}
+
+		// createOptions validates the optional networking and resource fields.
+		createOptions := func(c *gin.Context, req CreateContainerRequest) (podmanapi.CreateOptions, bool) {
+			opts := podmanapi.CreateOptions{
+				Network:   req.Network,
+				Aliases:   req.Aliases,
+				Ports:     req.Ports,
+				Bandwidth: req.Bandwidth,
+				CPUs:      req.CPUs,
+				MemLimit:  req.MemLimit,
+			}
+			if err := podmanapi.ValidateAliases(req.Aliases); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return opts, false
+			}
+			if req.IP != "" {
+				opts.StaticIP = net.ParseIP(req.IP)
+				if opts.StaticIP == nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid IP address: " + req.IP})
+					return opts, false
+				}
+			}
+			return opts, true
 		}
 
 		api.POST("/create", func(c *gin.Context) {
@@ -168,24 +243,15 @@ func RegisterContainerRoutes(router *gin.Engine) {
 				c.JSON(http.StatusBadRequest, gin.H{"message": "Container with name already exists"})
 				return
 			}
-			containerID := ""
-			ip := net.IP{}
-			if req.IP != "" {
-				// create a static IP
-				ip = net.ParseIP(req.IP)
-				// create the container
-				containerID, err = podmanapi.CreateFromImage(podmanContext, imageName, containerName, ip, req.CPUs, req.MemLimit)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
-					return
-				}
-			} else {
-				// create the container
-				containerID, err = podmanapi.CreateFromImage(podmanContext, imageName, containerName, nil, req.CPUs, req.MemLimit)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
-					return
-				}
+			opts, ok := createOptions(c, req)
+			if !ok {
+				return
+			}
+			// create the container, the next free IP is leased when none was requested
+			containerID, err := podmanapi.CreateFromImage(podmanContext, imageName, containerName, opts)
+			if err != nil {
+				c.JSON(errorStatus(err), gin.H{"message": err.Error()})
+				return
 			}
 			// start the container
 			_, err = podmanapi.StartPodmanContainer(podmanContext, containerID)
@@ -220,7 +286,14 @@ func RegisterContainerRoutes(router *gin.Engine) {
 		// expects data in form-data in the format:
 		// image: <image name>
 		// name: <container name>
-		// ip: <static container ip> (optional)
+		// ip: <static container ip> (optional, next free address on the network when empty)
+		// network: <network name> (optional, defaults to podman)
+		// aliases: [<dns alias>, ...] (optional, resolvable on networks with dns_enabled)
+		// ports: [{host_ip, host_port, container_port, protocol}] (optional, host_port 0 is auto-assigned)
+		// bandwidth: {ingress_kbit, egress_kbit} (optional, 0 is unlimited)
+		// privileged: <true|false> (optional, runs the container privileged)
+		// capabilities: [CAP_BPF, CAP_PERFMON, CAP_NET_ADMIN] (optional, not with privileged, all by default)
+		// mount_profile: <profile name> (optional, host mounts from the config, the default profile when empty)
 		api.POST("/create-ebpf", func(c *gin.Context) {
 			var req CreateContainerRequest
 			if err := c.ShouldBindJSON(&req); err != nil {
@@ -246,25 +319,32 @@ func RegisterContainerRoutes(router *gin.Engine) {
 				c.JSON(http.StatusBadRequest, gin.H{"message": "Container with name already exists"})
 				return
 			}
-			containerID := ""
-			ip := net.IP{}
-			if req.IP != "" {
-				// create a static IP
-				ip = net.ParseIP(req.IP)
-				// create the container
-				containerID, err = podmanapi.CreateEBPFContainer(podmanContext, imageName, containerName, ip, req.CPUs, req.MemLimit)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
-					return
-				}
-			} else {
-				// create the container
-				containerID, err = podmanapi.CreateEBPFContainer(podmanContext, imageName, containerName, nil, req.CPUs, req.MemLimit)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			opts, ok := createOptions(c, req)
+			if !ok {
+				return
+			}
+			if req.Privileged && len(req.Capabilities) > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "capabilities cannot be selected for privileged containers"})
+				return
+			}
+			opts.Privileged = req.Privileged
+			if !req.Privileged {
+				if opts.Capabilities, err = podmanapi.ValidateEBPFCapabilities(req.Capabilities); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 					return
 				}
 			}
+			if err := podmanapi.ValidateMountProfile(req.MountProfile); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			opts.MountProfile = req.MountProfile
+			// create the container, the next free IP is leased when none was requested
+			containerID, err := podmanapi.CreateEBPFContainer(podmanContext, imageName, containerName, opts)
+			if err != nil {
+				c.JSON(errorStatus(err), gin.H{"message": err.Error()})
+				return
+			}
 			// start the container
 			_, err = podmanapi.StartPodmanContainer(podmanContext, containerID)
 			if err != nil {
@@ -1,7 +1,13 @@
 package routes
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sonarping/go-nodeapi/pkg/podmanapi"
@@ -50,6 +56,11 @@ func RegisterEBPFRoutes(router *gin.Engine) {
 			// Start the EBPF service
 			_, err = podmanapi.StartEBPFService(podmanContext, id, ebpfService)
 			if err != nil {
+				logs := podmanapi.RecentEBPFServiceLogs(podmanContext, id, ebpfService, 10)
+				if len(logs) > 0 {
+					c.String(http.StatusInternalServerError, "Error starting EBPF Service: %v\n\nLast log lines:\n%s", err, strings.Join(logs, "\n"))
+					return
+				}
 				c.String(http.StatusInternalServerError, "Error starting EBPF Service: %v", err)
 				return
 			}
@@ -75,5 +86,372 @@ func RegisterEBPFRoutes(router *gin.Engine) {
 			}
 			c.JSON(http.StatusOK, gin.H{"message": "EBPF service stopped successfully"})
 		})
+
+		// reports whether eBPF environments can be created on this node, pass
+		// image to check another image than base_ebpf and profile to check
+		// another mount profile than the default
+		ebpf.GET("/preflight", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, podmanapi.CheckEBPFPreflight(podmanContext, c.Query("image"), c.Query("profile")))
+		})
+
+		// lists the mount profiles eBPF environments can be created with
+		ebpf.GET("/mount-profiles", func(c *gin.Context) {
+			profiles, def, err := podmanapi.MountProfiles()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error reading mount profiles: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"profiles": profiles, "default": def})
+		})
+
+		// lists the BPF programs, maps and links loaded on this node, pass
+		// container_id to only get those of one container
+		ebpf.GET("/loaded", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			objects, err := podmanapi.GetBPFObjects(podmanContext, c.Query("container_id"))
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error listing BPF objects: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, objects)
+		})
+
+		// dumps a map of a container, expects query parameters:
+		// id: <map id> or pinned: <path below /sys/fs/bpf inside the container>
+		// offset: <index of the first entry> (optional)
+		// limit: <number of entries, at most 1000> (optional, default 100)
+		ebpf.GET("/maps/:container_id", func(c *gin.Context) {
+			req := podmanapi.MapDumpRequest{Pinned: c.Query("pinned")}
+			for key, dst := range map[string]*int{"offset": &req.Offset, "limit": &req.Limit} {
+				if value := c.Query(key); value != "" {
+					n, err := strconv.Atoi(value)
+					if err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("invalid %s %q", key, value)})
+						return
+					}
+					*dst = n
+				}
+			}
+			if id := c.Query("id"); id != "" {
+				n, err := strconv.ParseUint(id, 10, 32)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("invalid id %q", id)})
+					return
+				}
+				req.ID = uint32(n)
+			}
+			if err := req.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			dump, err := podmanapi.DumpBPFMap(podmanContext, c.Param("container_id"), req)
+			if err != nil {
+				c.String(errorStatus(err), "Error dumping BPF map: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, dump)
+		})
+
+		// returns the journal of an ebpf_ unit, expects query parameters:
+		// lines: <number of most recent entries> (optional, default 100)
+		// since: <unix timestamp or journalctl time, e.g. "-1h"> (optional)
+		// priority: <0-7 or emerg..debug> (optional)
+		// follow: <true|false> streams the journal as plain text until the client disconnects
+		ebpf.GET("/logs/:container_id/:service", func(c *gin.Context) {
+			opts := podmanapi.JournalOptions{
+				Since:    c.Query("since"),
+				Priority: c.Query("priority"),
+				Follow:   c.Query("follow") == "true",
+			}
+			if lines := c.Query("lines"); lines != "" {
+				n, err := strconv.Atoi(lines)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("invalid lines %q", lines)})
+					return
+				}
+				opts.Lines = n
+			}
+			if err := opts.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			id := c.Param("container_id")
+			service := c.Param("service")
+			if !opts.Follow {
+				entries, err := podmanapi.GetEBPFServiceLogs(podmanContext, id, service, opts)
+				if err != nil {
+					c.String(http.StatusInternalServerError, "Error getting EBPF service logs: %v", err)
+					return
+				}
+				c.JSON(http.StatusOK, entries)
+				return
+			}
+			disableDeadlines(c)
+			// keep the podman connection but stop following once the client is gone
+			streamContext, cancel := context.WithCancel(podmanContext)
+			defer cancel()
+			stop := context.AfterFunc(c.Request.Context(), cancel)
+			defer stop()
+			c.Header("Content-Type", "text/plain; charset=utf-8")
+			c.Status(http.StatusOK)
+			if err := podmanapi.StreamEBPFServiceLogs(streamContext, id, service, opts, flushWriter{c}); err != nil {
+				if !c.Writer.Written() {
+					c.String(http.StatusInternalServerError, "Error streaming EBPF service logs: %v", err)
+					return
+				}
+				log.Printf("Error streaming logs of %s in %s: %v", service, id, err)
+			}
+		})
+
+		// starts, stops or restarts units in several containers, expects JSON:
+		// action: <start|stop|restart>
+		// units: [<ebpf_ unit name>, ...]
+		// containers: [<container name or id>, ...] or label: <key or key=value>
+		ebpf.POST("/batch", func(c *gin.Context) {
+			var req podmanapi.EBPFBatchRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			if err := podmanapi.ValidateEBPFBatchRequest(req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			results, err := podmanapi.RunEBPFBatch(podmanContext, req)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error running EBPF batch: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, results)
+		})
+
+		// enable, disable and restart expect the same JSON as start and stop
+		// and return the unit status
+		unitActions := map[string]func(context.Context, string, string) (podmanapi.EBPFServiceStatus, error){
+			"enable":  podmanapi.EnableEBPFService,
+			"disable": podmanapi.DisableEBPFService,
+			"restart": podmanapi.RestartEBPFService,
+		}
+		for action, run := range unitActions {
+			ebpf.POST("/ebpf-"+action+"-service", func(c *gin.Context) {
+				var req EBPFServiceRequest
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+					return
+				}
+				podmanContext, err := podmanapi.InitPodmanConnection()
+				if err != nil {
+					c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+					return
+				}
+				status, err := run(podmanContext, req.ContainerID, req.EBPFService)
+				if err != nil {
+					c.String(http.StatusInternalServerError, "Error running %s on EBPF Service: %v", action, err)
+					return
+				}
+				c.JSON(http.StatusOK, status)
+			})
+		}
+
+		// the units started whenever the container is started through the API
+		ebpf.GET("/units/:container_id", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			units, err := podmanapi.GetDesiredEBPFUnits(podmanContext, c.Param("container_id"))
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error getting EBPF units: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"units": units})
+		})
+
+		// replaces the stored units, expects JSON {"units": [<ebpf_ unit name>, ...]},
+		// units of a running container are started right away
+		type EBPFUnitsRequest struct {
+			Units []string `json:"units"`
+		}
+		ebpf.POST("/units/:container_id", func(c *gin.Context) {
+			var req EBPFUnitsRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			results, err := podmanapi.SetDesiredEBPFUnits(podmanContext, c.Param("container_id"), req.Units)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error storing EBPF units: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, results)
+		})
+
+		// the output collected from a container's ebpf_ units
+		ebpf.GET("/collector/:container_id", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			config, err := podmanapi.GetCollectorConfig(podmanContext, c.Param("container_id"))
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error getting EBPF output collector: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, config)
+		})
+
+		// replaces what is collected, expects JSON:
+		// sources: [{"unit": <ebpf_ unit>, "path": <file in the container, empty for the unit's output>}, ...]
+		// max_file_bytes: <rotation size> (optional, default 10MiB)
+		// max_files: <rotated files kept> (optional, default 5)
+		// keep: <true|false> keep the output after the container is removed
+		ebpf.POST("/collector/:container_id", func(c *gin.Context) {
+			var config podmanapi.CollectorConfig
+			if err := c.ShouldBindJSON(&config); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			if err := config.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			if err := podmanapi.SetCollectorConfig(podmanContext, c.Param("container_id"), config); err != nil {
+				c.String(http.StatusInternalServerError, "Error configuring EBPF output collector: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "EBPF output collector configured successfully"})
+		})
+
+		// lists the output collected for a job (container name), also after
+		// the container was removed
+		ebpf.GET("/output/:job", func(c *gin.Context) {
+			files, err := podmanapi.ListOutputFiles(c.Param("job"))
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, files)
+		})
+
+		// downloads a collected file, pass follow=true to keep streaming what
+		// is appended until the client disconnects
+		ebpf.GET("/output/:job/:file", func(c *gin.Context) {
+			follow := c.Query("follow") == "true"
+			if follow {
+				disableDeadlines(c)
+			} else {
+				c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", c.Param("file")))
+			}
+			c.Header("Content-Type", "text/plain; charset=utf-8")
+			if err := podmanapi.StreamOutputFile(c.Request.Context(), c.Param("job"), c.Param("file"), flushWriter{c}, follow); err != nil {
+				if !c.Writer.Written() {
+					c.Header("Content-Disposition", "")
+					c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+					return
+				}
+				log.Printf("Error streaming output %s of %s: %v", c.Param("file"), c.Param("job"), err)
+			}
+		})
+
+		// expects data in multipart form-data in the format:
+		// container_id: <container id>
+		// name: <unit name, ebpf_<name>>
+		// program: <object file or source> (file)
+		// build_command: <shell command run in the program directory> (optional)
+		// unit: <unit file contents> (optional, generated from exec_start when empty)
+		// exec_start: <command running the program> (required without unit)
+		// enable: <true|false>
+		// start: <true|false>
+		ebpf.POST("/deploy", func(c *gin.Context) {
+			disableDeadlines(c)
+			containerID := c.PostForm("container_id")
+			if containerID == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "container_id is required"})
+				return
+			}
+			req := podmanapi.EBPFDeployRequest{
+				Name:         c.PostForm("name"),
+				BuildCommand: c.PostForm("build_command"),
+				Unit:         c.PostForm("unit"),
+				ExecStart:    c.PostForm("exec_start"),
+			}
+			var err error
+			if req.Enable, err = parseBoolForm(c, "enable"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			if req.Start, err = parseBoolForm(c, "start"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			fh, err := c.FormFile("program")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "program file is required"})
+				return
+			}
+			f, err := fh.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			req.ProgramName = fh.Filename
+			req.Program, err = io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			if err := podmanapi.ValidateEBPFDeployRequest(req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			status, err := podmanapi.DeployEBPFProgram(podmanContext, containerID, req)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error deploying EBPF program: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, status)
+		})
 	}
 }
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sonarping/go-nodeapi/pkg/podmanapi"
+	"github.com/sonarping/go-nodeapi/pkg/trust"
+)
+
+// disableDeadlines lifts the server read/write timeouts for handlers that
+// accept large uploads or stream long-running output.
+func disableDeadlines(c *gin.Context) {
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("Error clearing read deadline: %v", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Error clearing write deadline: %v", err)
+	}
+}
+
+// parseBoolForm reads an optional boolean form field, defaulting to false.
+func parseBoolForm(c *gin.Context, key string) (bool, error) {
+	value := c.PostForm(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for %s: %q", key, value)
+	}
+	return b, nil
+}
+
+// deferredHeaderWriter sends the attachment headers on the first write, so a
+// handler can still answer with an error if the download fails up front.
+type deferredHeaderWriter struct {
+	c        *gin.Context
+	filename string
+	started  bool
+}
+
+func (w *deferredHeaderWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		if strings.HasSuffix(w.filename, ".gz") {
+			w.c.Header("Content-Type", "application/gzip")
+		} else {
+			w.c.Header("Content-Type", "application/x-tar")
+		}
+		w.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", w.filename))
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
+}
+
+// flushWriter flushes after every write so streamed output reaches the
+// client as it is produced.
+type flushWriter struct {
+	c *gin.Context
+}
+
+func (w flushWriter) Write(p []byte) (int, error) {
+	n, err := w.c.Writer.Write(p)
+	w.c.Writer.Flush()
+	return n, err
+}
+
+// errorStatus maps errors with a known cause to a client error status and
+// everything else to 500.
+func errorStatus(err error) int {
+	var rejected *trust.RejectedError
+	if errors.As(err, &rejected) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, podmanapi.ErrIPUnavailable) || errors.Is(err, podmanapi.ErrPortUnavailable) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, podmanapi.ErrMapNotOwned) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, podmanapi.ErrDNSDisabled) || errors.Is(err, podmanapi.ErrNotShapeable) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, podmanapi.ErrEBPFNotReady) {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
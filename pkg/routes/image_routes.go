@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"io"
+	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sonarping/go-nodeapi/pkg/podmanapi"
@@ -39,26 +42,322 @@ func RegisterImageRoutes(router *gin.Engine) {
 			}
 			c.JSON(http.StatusOK, status)
 		})
-		// api.POST("/build", func(c *gin.Context) {
-		// 	// expects data in form-data in the format:
-		// 	// dockerfile: <dockerfile content>
-		// 	// label: <image label>
-		// 	podmanContext, err := podmanapi.InitPodmanConnection()
-		// 	if err != nil {
-		// 		c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
-		// 	}
-		// 	dockerFile := c.PostForm("dockerfile")
-		// 	imageLabel := c.PostForm("label")
-		// 	if dockerFile == "" || imageLabel == "" {
-		// 		c.String(http.StatusBadRequest, "Dockerfile and Label are required")
-		// 		return
-		// 	}
-		// 	imageID, err := podmanapi.BuildFromDockerFile(podmanContext, dockerFile, imageLabel)
-		// 	if err != nil {
-		// 		c.String(http.StatusInternalServerError, "Error building Podman Images: %v", err)
-		// 		return
-		// 	}
-		// 	c.JSON(http.StatusOK, imageID)
-		// })
+		// expects multipart form-data in the format:
+		// dockerfile: <dockerfile file or content> (optional if the context has a Dockerfile)
+		// context: <build context tarball> (optional)
+		// tags: <image tag> (repeatable, at least one)
+		// build_args: <KEY=VALUE> (repeatable)
+		// target: <target stage>
+		// no_cache: <true|false>
+		// squash: <true|false>
+		api.POST("/build", func(c *gin.Context) {
+			disableDeadlines(c)
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			req := podmanapi.ImageBuildRequest{
+				Tags:      c.PostFormArray("tags"),
+				BuildArgs: map[string]string{},
+				Target:    c.PostForm("target"),
+			}
+			if len(req.Tags) == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "At least one tag is required"})
+				return
+			}
+			for _, arg := range c.PostFormArray("build_args") {
+				key, value, ok := strings.Cut(arg, "=")
+				if !ok || key == "" {
+					c.JSON(http.StatusBadRequest, gin.H{"message": "Build args must be in the format KEY=VALUE"})
+					return
+				}
+				req.BuildArgs[key] = value
+			}
+			if req.NoCache, err = parseBoolForm(c, "no_cache"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			if req.Squash, err = parseBoolForm(c, "squash"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			if fh, err := c.FormFile("dockerfile"); err == nil {
+				f, err := fh.Open()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+					return
+				}
+				req.Dockerfile, err = io.ReadAll(f)
+				f.Close()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+					return
+				}
+			} else {
+				req.Dockerfile = []byte(c.PostForm("dockerfile"))
+			}
+			if fh, err := c.FormFile("context"); err == nil {
+				f, err := fh.Open()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+					return
+				}
+				defer f.Close()
+				req.Context = f
+			}
+			if len(req.Dockerfile) == 0 && req.Context == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "A Dockerfile or a build context is required"})
+				return
+			}
+			build, err := podmanapi.StartImageBuild(podmanContext, req)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			c.JSON(http.StatusAccepted, build)
+		})
+		api.GET("/build", func(c *gin.Context) {
+			c.JSON(http.StatusOK, podmanapi.ListImageBuilds())
+		})
+		api.GET("/build/:id", func(c *gin.Context) {
+			build, err := podmanapi.GetImageBuild(c.Param("id"))
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, build)
+		})
+		// streams the build output as plain text, pass follow=true to keep
+		// streaming until the build finishes
+		api.GET("/build/:id/logs", func(c *gin.Context) {
+			follow := c.Query("follow") == "true"
+			if follow {
+				disableDeadlines(c)
+			}
+			id := c.Param("id")
+			if _, err := podmanapi.GetImageBuild(id); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+				return
+			}
+			c.Header("Content-Type", "text/plain; charset=utf-8")
+			c.Status(http.StatusOK)
+			if err := podmanapi.StreamImageBuild(c.Request.Context(), id, c.Writer, follow); err != nil {
+				log.Printf("Error streaming build %s: %v", id, err)
+			}
+		})
+
+		type ImageTagRequest struct {
+			Image  string `json:"image" binding:"required"`
+			Target string `json:"target" binding:"required"`
+		}
+		api.POST("/tag", func(c *gin.Context) {
+			var req ImageTagRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			if err := podmanapi.TagImage(podmanContext, req.Image, req.Target); err != nil {
+				c.String(http.StatusInternalServerError, "Error tagging Podman Image: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "Image tagged successfully"})
+		})
+		api.POST("/untag", func(c *gin.Context) {
+			var req ImageTagRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			if err := podmanapi.UntagImage(podmanContext, req.Image, req.Target); err != nil {
+				c.String(http.StatusInternalServerError, "Error untagging Podman Image: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "Image untagged successfully"})
+		})
+
+		type ImagePushRequest struct {
+			Image         string `json:"image" binding:"required"`
+			Destination   string `json:"destination"`
+			Username      string `json:"username"`
+			Password      string `json:"password"`
+			SkipTLSVerify bool   `json:"skip_tls_verify"`
+		}
+		api.POST("/push", func(c *gin.Context) {
+			var req ImagePushRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			disableDeadlines(c)
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			creds := podmanapi.RegistryCredentials{
+				Username:      req.Username,
+				Password:      req.Password,
+				SkipTLSVerify: req.SkipTLSVerify,
+			}
+			if err := podmanapi.PushImage(podmanContext, req.Image, req.Destination, creds); err != nil {
+				c.String(http.StatusInternalServerError, "Error pushing Podman Image: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "Image pushed successfully"})
+		})
+		// image names may contain slashes, so the reference is taken from the rest of the path
+		api.GET("/inspect/*image", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			image := strings.TrimPrefix(c.Param("image"), "/")
+			details, err := podmanapi.InspectImage(podmanContext, image)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error inspecting Podman Image: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, details)
+		})
+		api.GET("/history/*image", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			image := strings.TrimPrefix(c.Param("image"), "/")
+			history, err := podmanapi.GetImageHistory(podmanContext, image)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error getting Podman Image history: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, history)
+		})
+		// streams the images as a tar archive, expects query parameters:
+		// name: <image name or id> (repeatable)
+		// format: docker-archive (default) or oci-archive
+		// compress: <true|false> (gzips the archive)
+		api.GET("/save", func(c *gin.Context) {
+			disableDeadlines(c)
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			names := c.QueryArray("name")
+			format := c.DefaultQuery("format", podmanapi.ArchiveFormatDocker)
+			compress := c.Query("compress") == "true"
+			// headers are only sent with the first data, so early errors can still be reported
+			w := &deferredHeaderWriter{c: c, filename: "images.tar"}
+			if compress {
+				w.filename = "images.tar.gz"
+			}
+			if err := podmanapi.SaveImages(podmanContext, names, format, compress, w); err != nil {
+				if w.started {
+					log.Printf("Error streaming image archive: %v", err)
+					return
+				}
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+		})
+		// loads images from a tar archive sent either as the raw request body
+		// or as the "archive" field of a multipart form
+		api.POST("/load", func(c *gin.Context) {
+			disableDeadlines(c)
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			var archive io.Reader = c.Request.Body
+			if strings.HasPrefix(c.ContentType(), "multipart/") {
+				fh, err := c.FormFile("archive")
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": "An image archive is required"})
+					return
+				}
+				f, err := fh.Open()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+					return
+				}
+				defer f.Close()
+				archive = f
+			}
+			names, err := podmanapi.LoadImages(podmanContext, archive)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error loading Podman Images: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "Images loaded successfully", "images": names})
+		})
+
+		type ImageVerifyRequest struct {
+			Image string `json:"image" binding:"required"`
+		}
+		// evaluates the node trust policy for an image, allowed is false with
+		// the reasons listed when the image would be rejected
+		api.POST("/verify", func(c *gin.Context) {
+			var req ImageVerifyRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			decision, err := podmanapi.VerifyImage(podmanContext, req.Image)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error verifying Podman Image: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, decision)
+		})
+
+		type ImagePullRequest struct {
+			Image         string `json:"image" binding:"required"`
+			Username      string `json:"username"`
+			Password      string `json:"password"`
+			SkipTLSVerify bool   `json:"skip_tls_verify"`
+		}
+		api.POST("/pull", func(c *gin.Context) {
+			var req ImagePullRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			disableDeadlines(c)
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			creds := podmanapi.RegistryCredentials{
+				Username:      req.Username,
+				Password:      req.Password,
+				SkipTLSVerify: req.SkipTLSVerify,
+			}
+			pulled, err := podmanapi.PullImage(podmanContext, req.Image, creds)
+			if err != nil {
+				c.JSON(errorStatus(err), gin.H{"message": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "Image pulled successfully", "images": pulled})
+		})
 	}
 }
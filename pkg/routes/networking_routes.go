@@ -1,10 +1,12 @@
 package routes
 
 import (
+	"context"
 	"net"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sonarping/go-nodeapi/pkg/netpolicy"
 	"github.com/sonarping/go-nodeapi/pkg/podmanapi"
 )
 
@@ -23,33 +25,32 @@ func RegisterNetworkingRoutes(router *gin.Engine) {
 			}
 			c.JSON(http.StatusOK, podmanNetworks)
 		})
+		// expects a JSON body in the format:
+		// name: <network name>
+		// driver: bridge (default), macvlan or ipvlan
+		// parent: <host interface for macvlan/ipvlan>
+		// subnets: [{subnet: <CIDR>, gateway: <ip>, range_start: <ip>, range_end: <ip>}, ...]
+		// internal: <no external connectivity>
+		// dns_enabled: <resolve container names on this network>
+		// labels: {<key>: <value>, ...}
 		api.POST("/create", func(c *gin.Context) {
-			// expects data in form-data in the format:
-			// name: <network name>
-			// network-ip: <network ip>
-			// netmask: <network netmask>
-			// gateway: <network gateway>
-
-			// generates net.IPNet from network-ip, netmask and net.IP from gateway
-
-			netName := c.PostForm("name")
-			netIPNet := net.IPNet{
-				IP:   net.ParseIP(c.PostForm("network-ip")),
-				Mask: net.IPMask(net.ParseIP(c.PostForm("netmask"))),
+			var req podmanapi.NetworkCreateOptions
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
 			}
-			gateway := net.ParseIP(c.PostForm("gateway"))
-
-			if netName == "" || netIPNet.IP == nil || netIPNet.Mask == nil || gateway == nil {
-				c.String(http.StatusBadRequest, "Name, Network IP, Netmask and Gateway are required. Please provide valid values.")
+			if err := podmanapi.ValidateNetworkCreateOptions(req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 				return
 			}
 			podmanContext, err := podmanapi.InitPodmanConnection()
 			if err != nil {
 				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
 			}
-			err = podmanapi.InitNewNetwork(podmanContext, netName, netIPNet, gateway)
+			err = podmanapi.InitNewNetwork(podmanContext, req)
 			if err != nil {
-				c.String(http.StatusInternalServerError, "Error creating Podman Containers: %v", err)
+				c.String(http.StatusInternalServerError, "Error creating network: %v", err)
 				return
 			}
 			c.JSON(http.StatusOK, gin.H{"status": "Network created successfully"})
@@ -67,19 +68,207 @@ func RegisterNetworkingRoutes(router *gin.Engine) {
 			}
 			c.JSON(http.StatusOK, gin.H{"status": "Network removed successfully"})
 		})
+		// accepts an optional JSON body in the format:
+		// ips: [<static ip>, ...]
+		// mac: <static mac address>
+		// aliases: [<dns alias>, ...]
+		type AttachNetworkRequest struct {
+			IPs     []string `json:"ips"`
+			MAC     string   `json:"mac"`
+			Aliases []string `json:"aliases"`
+		}
 		api.POST("/attach/:containerID/:networkName", func(c *gin.Context) {
+			var req AttachNetworkRequest
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+					return
+				}
+			}
+			var opts podmanapi.AttachOptions
+			for _, ipStr := range req.IPs {
+				ip := net.ParseIP(ipStr)
+				if ip == nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid IP address: " + ipStr})
+					return
+				}
+				opts.StaticIPs = append(opts.StaticIPs, ip)
+			}
+			if req.MAC != "" {
+				mac, err := net.ParseMAC(req.MAC)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+					return
+				}
+				opts.StaticMAC = mac
+			}
+			if err := podmanapi.ValidateAliases(req.Aliases); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			opts.Aliases = req.Aliases
 			podmanContext, err := podmanapi.InitPodmanConnection()
 			if err != nil {
 				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
 			}
 			containerID := c.Param("containerID")
 			networkName := c.Param("networkName")
-			ip, err := podmanapi.AttachContainerToNetwork(podmanContext, containerID, networkName)
+			ip, err := podmanapi.AttachContainerToNetwork(podmanContext, containerID, networkName, opts)
 			if err != nil {
-				c.String(http.StatusInternalServerError, "Error attaching container to network: %v", err)
+				c.String(errorStatus(err), "Error attaching container to network: %v", err)
 				return
 			}
 			c.JSON(http.StatusOK, gin.H{"status": "Container attached to network successfully", "ip": ip})
 		})
+		api.POST("/detach/:containerID/:networkName", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			containerID := c.Param("containerID")
+			networkName := c.Param("networkName")
+			force := c.Query("force") == "true"
+			err = podmanapi.DetachContainerFromNetwork(podmanContext, containerID, networkName, force)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error detaching container from network: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "Container detached from network successfully"})
+		})
+		api.GET("/inspect/:name", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			details, err := podmanapi.InspectNetwork(podmanContext, c.Param("name"))
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error inspecting network: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, details)
+		})
+		// lists the names containers resolve on the DNS enabled networks of this node
+		api.GET("/dns", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			records, err := podmanapi.GetDNSRecords(podmanContext)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error listing DNS records: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, records)
+		})
+		api.GET("/stats", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			stats, err := podmanapi.GetTrafficStats(podmanContext)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error collecting traffic statistics: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, stats)
+		})
+		api.GET("/policy", func(c *gin.Context) {
+			policies, err := netpolicy.List()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error reading network policies: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, policies)
+		})
+		api.GET("/policy/:container", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			name, ok := policyContainerName(c, podmanContext)
+			if !ok {
+				return
+			}
+			policy, _, err := netpolicy.Get(name)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error reading network policy: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, policy)
+		})
+		// expects a JSON body in the format:
+		// deny_egress: <drop new outgoing connections except DNS and group members>
+		// ingress: all (default), proxy (only the nginx proxy) or group (proxy and group members)
+		// group: <group name>
+		api.POST("/policy/:container", func(c *gin.Context) {
+			var policy netpolicy.Policy
+			if err := c.ShouldBindJSON(&policy); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			if err := policy.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			name, ok := policyContainerName(c, podmanContext)
+			if !ok {
+				return
+			}
+			if err := netpolicy.Set(name, policy); err != nil {
+				c.String(http.StatusInternalServerError, "Error saving network policy: %v", err)
+				return
+			}
+			if err := podmanapi.ReconcileNetworkPolicies(podmanContext); err != nil {
+				c.String(http.StatusInternalServerError, "Error applying network policies: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "Network policy applied successfully"})
+		})
+		api.POST("/policy/:container/remove", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			name, ok := policyContainerName(c, podmanContext)
+			if !ok {
+				return
+			}
+			if err := netpolicy.Delete(name); err != nil {
+				c.String(http.StatusInternalServerError, "Error removing network policy: %v", err)
+				return
+			}
+			if err := podmanapi.ReconcileNetworkPolicies(podmanContext); err != nil {
+				c.String(http.StatusInternalServerError, "Error applying network policies: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "Network policy removed successfully"})
+		})
+	}
+}
+
+// policyContainerName resolves the :container parameter, which may be an ID,
+// to the container name policies are stored under.
+func policyContainerName(c *gin.Context, podmanContext context.Context) (string, bool) {
+	name, err := podmanapi.GetContainerName(podmanContext, c.Param("container"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error inspecting container: %v", err)
+		return "", false
+	}
+	if name == "" {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Container not found"})
+		return "", false
 	}
+	return name, true
 }
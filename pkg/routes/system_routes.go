@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sonarping/go-nodeapi/pkg/podmanapi"
+)
+
+func RegisterSystemRoutes(router *gin.Engine) {
+	api := router.Group("/system")
+	{
+		api.GET("/df", func(c *gin.Context) {
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			usage, err := podmanapi.GetDiskUsage(podmanContext)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error getting disk usage: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, usage)
+		})
+		// expects a JSON body in the format:
+		// images: <prune dangling images>
+		// all_images: <prune all images not used by a container>
+		// build_cache: <prune the build cache>
+		// containers: <prune stopped containers>
+		// volumes: <prune unused volumes>
+		// until: <only prune resources created before this timestamp/duration>
+		// labels: <only prune resources with these labels>
+		// dry_run: <only report what would be removed>
+		api.POST("/prune", func(c *gin.Context) {
+			var req podmanapi.PruneOptions
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			if !req.Images && !req.AllImages && !req.BuildCache && !req.Containers && !req.Volumes {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Nothing selected to prune"})
+				return
+			}
+			disableDeadlines(c)
+			podmanContext, err := podmanapi.InitPodmanConnection()
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error connecting to Podman Socket: %v", err)
+				return
+			}
+			report, err := podmanapi.Prune(podmanContext, req)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Error pruning: %v", err)
+				return
+			}
+			c.JSON(http.StatusOK, report)
+		})
+	}
+}
@@ -3,7 +3,13 @@ package systemd
 import (
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
 
+	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/godbus/dbus/v5"
 )
 
@@ -43,3 +49,241 @@ func ReloadUnit(unit string, mode string) error {
 	fmt.Printf("Reload job queued for %s; job path: %s\n", unit, jobPath)
 	return nil
 }
+
+// root of the container filesystems, see proc(5) /proc/<pid>/root
+var procRoot = "/proc"
+
+// UnitStatus is the state of a unit as systemctl status reports it.
+type UnitStatus struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	// last change of ActiveState, zero if it never changed
+	Since   time.Time
+	MainPID uint32
+	// enabled, disabled, static, ...; empty for units without a unit file
+	UnitFileState string
+}
+
+// Conn is a connection to the systemd instance running inside a container.
+type Conn struct {
+	conn    *dbus.Conn
+	manager dbus.BusObject
+}
+
+// DialContainer connects to systemd in the container whose init has pid.
+// systemd's private socket needs no dbus-daemon in the container; the
+// system bus socket is tried when the private one is missing.
+func DialContainer(pid int) (*Conn, error) {
+	root := filepath.Join(procRoot, strconv.Itoa(pid), "root")
+
+	conn, err := dialSocket(root, "run/systemd/private", false)
+	if err != nil {
+		var busErr error
+		conn, busErr = dialSocket(root, "run/dbus/system_bus_socket", true)
+		if busErr != nil {
+			return nil, fmt.Errorf("failed to connect to systemd in container: %v; %v", err, busErr)
+		}
+	}
+	return &Conn{
+		conn:    conn,
+		manager: conn.Object("org.freedesktop.systemd1", dbus.ObjectPath("/org/freedesktop/systemd1")),
+	}, nil
+}
+
+// dialSocket connects to the socket at path inside root. The path is
+// resolved inside root and the socket dialed through the opened file, so a
+// symlink in the container cannot redirect the daemon to the host's systemd.
+func dialSocket(root string, path string, hello bool) (*dbus.Conn, error) {
+	handle, err := securejoin.OpenInRoot(root, path)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	fi, err := handle.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return nil, fmt.Errorf("%s is not a socket", path)
+	}
+	conn, err := dbus.Dial(fmt.Sprintf("unix:path=/proc/self/fd/%d", handle.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if hello {
+		if err := conn.Hello(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// ListUnits returns the status of all unit files matching pattern, whether
+// they are loaded or not.
+func (c *Conn) ListUnits(pattern string) ([]UnitStatus, error) {
+	var files []struct {
+		Path  string
+		State string
+	}
+	err := c.manager.Call("org.freedesktop.systemd1.Manager.ListUnitFilesByPatterns", 0, []string{}, []string{pattern}).Store(&files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unit files: %v", err)
+	}
+	if len(files) == 0 {
+		return []UnitStatus{}, nil
+	}
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, filepath.Base(f.Path))
+	}
+	sort.Strings(names)
+	return c.unitStatuses(names)
+}
+
+func (c *Conn) unitStatuses(names []string) ([]UnitStatus, error) {
+	// loads the units that are not in memory yet, without starting them
+	var units []struct {
+		Name        string
+		Description string
+		LoadState   string
+		ActiveState string
+		SubState    string
+		Following   string
+		Path        dbus.ObjectPath
+		JobID       uint32
+		JobType     string
+		JobPath     dbus.ObjectPath
+	}
+	err := c.manager.Call("org.freedesktop.systemd1.Manager.ListUnitsByNames", 0, names).Store(&units)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list units: %v", err)
+	}
+
+	statuses := make([]UnitStatus, 0, len(units))
+	for _, u := range units {
+		status := UnitStatus{
+			Name:        u.Name,
+			Description: u.Description,
+			LoadState:   u.LoadState,
+			ActiveState: u.ActiveState,
+			SubState:    u.SubState,
+		}
+		obj := c.conn.Object("org.freedesktop.systemd1", u.Path)
+		if v, err := obj.GetProperty("org.freedesktop.systemd1.Unit.StateChangeTimestamp"); err == nil {
+			if usec, ok := v.Value().(uint64); ok && usec > 0 {
+				status.Since = time.UnixMicro(int64(usec))
+			}
+		}
+		if v, err := obj.GetProperty("org.freedesktop.systemd1.Unit.UnitFileState"); err == nil {
+			status.UnitFileState, _ = v.Value().(string)
+		}
+		// only services have a main process
+		if v, err := obj.GetProperty("org.freedesktop.systemd1.Service.MainPID"); err == nil {
+			status.MainPID, _ = v.Value().(uint32)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Reload makes systemd pick up new or changed unit files.
+func (c *Conn) Reload() error {
+	if err := c.manager.Call("org.freedesktop.systemd1.Manager.Reload", 0).Err; err != nil {
+		return fmt.Errorf("failed to reload systemd: %v", err)
+	}
+	return nil
+}
+
+// EnableUnit enables a unit file so it starts on the next boot of the container.
+func (c *Conn) EnableUnit(name string) error {
+	var carriesInstallInfo bool
+	var changes []struct {
+		Type        string
+		Filename    string
+		Destination string
+	}
+	err := c.manager.Call("org.freedesktop.systemd1.Manager.EnableUnitFiles", 0, []string{name}, false, true).Store(&carriesInstallInfo, &changes)
+	if err != nil {
+		return fmt.Errorf("failed to enable unit %s: %v", name, err)
+	}
+	// like systemctl enable, so the new symlinks are picked up
+	return c.Reload()
+}
+
+// DisableUnit disables a unit file so it no longer starts on boot. A running
+// unit keeps running.
+func (c *Conn) DisableUnit(name string) error {
+	var changes []struct {
+		Type        string
+		Filename    string
+		Destination string
+	}
+	err := c.manager.Call("org.freedesktop.systemd1.Manager.DisableUnitFiles", 0, []string{name}, false).Store(&changes)
+	if err != nil {
+		return fmt.Errorf("failed to disable unit %s: %v", name, err)
+	}
+	return c.Reload()
+}
+
+// StartUnit starts a unit and waits up to timeout for the start job to finish.
+func (c *Conn) StartUnit(name string, timeout time.Duration) (UnitStatus, error) {
+	return c.runJob("StartUnit", name, timeout)
+}
+
+// StopUnit stops a unit and waits for the job to finish.
+func (c *Conn) StopUnit(name string, timeout time.Duration) (UnitStatus, error) {
+	return c.runJob("StopUnit", name, timeout)
+}
+
+// RestartUnit restarts a unit, starting it if it is not running, and waits
+// for the job to finish.
+func (c *Conn) RestartUnit(name string, timeout time.Duration) (UnitStatus, error) {
+	return c.runJob("RestartUnit", name, timeout)
+}
+
+// runJob queues a unit job such as StartUnit and waits for it to finish,
+// then returns the unit status.
+func (c *Conn) runJob(method string, name string, timeout time.Duration) (UnitStatus, error) {
+	var jobPath dbus.ObjectPath
+	err := c.manager.Call("org.freedesktop.systemd1.Manager."+method, 0, name, "replace").Store(&jobPath)
+	if err != nil {
+		return UnitStatus{}, fmt.Errorf("failed to queue %s for %s: %v", method, name, err)
+	}
+	job := c.conn.Object("org.freedesktop.systemd1", jobPath)
+	deadline := time.Now().Add(timeout)
+	for {
+		// the job object goes away once the job has finished
+		if _, err := job.GetProperty("org.freedesktop.systemd1.Job.State"); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return UnitStatus{}, fmt.Errorf("timeout waiting for %s of %s", method, name)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return c.UnitStatus(name)
+}
+
+// UnitStatus returns the current status of a single unit.
+func (c *Conn) UnitStatus(name string) (UnitStatus, error) {
+	statuses, err := c.unitStatuses([]string{name})
+	if err != nil {
+		return UnitStatus{}, err
+	}
+	if len(statuses) == 0 {
+		return UnitStatus{}, fmt.Errorf("unit %s not found", name)
+	}
+	return statuses[0], nil
+}
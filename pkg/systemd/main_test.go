@@ -0,0 +1,66 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDialSocket_StaysInRoot(t *testing.T) {
+	// short paths, unix socket addresses are limited to 108 bytes
+	host, err := os.MkdirTemp("", "sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(host)
+	hostSocket := filepath.Join(host, "private")
+	l, err := net.Listen("unix", hostSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan bool, 1)
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			accepted <- true
+			c.Close()
+		}
+	}()
+
+	root := filepath.Join(host, "root")
+	os.MkdirAll(filepath.Join(root, "run/systemd"), 0755)
+	// absolute inside the container, pointing at the host's socket
+	os.Symlink(hostSocket, filepath.Join(root, "run/systemd/private"))
+
+	if _, err := dialSocket(root, "run/systemd/private", false); err == nil {
+		t.Fatalf("expected dialing through the symlink to fail")
+	}
+	select {
+	case <-accepted:
+		t.Errorf("expected the host socket not to be connected to")
+	default:
+	}
+
+	// the container's own socket is reached through the opened file, the
+	// fake server hangs up before authenticating
+	os.Remove(filepath.Join(root, "run/systemd/private"))
+	l2, err := net.Listen("unix", filepath.Join(root, "run/systemd/private"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	go func() {
+		if c, err := l2.Accept(); err == nil {
+			accepted <- true
+			c.Close()
+		}
+	}()
+	dialSocket(root, "run/systemd/private", false)
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Errorf("expected the container's socket to be connected to")
+	}
+}
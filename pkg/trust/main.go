@@ -0,0 +1,261 @@
+package trust
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/signature"
+	"github.com/opencontainers/go-digest"
+)
+
+const defaultSignaturePolicyPath = "/etc/containers/policy.json"
+
+// Policy decides which images a node is allowed to pull and run. The zero
+// value allows everything.
+type Policy struct {
+	// registries (e.g. "registry.lab.local") or repository prefixes
+	// (e.g. "registry.lab.local/ebpf") images may come from, empty allows all.
+	// Local images must have been pulled from them under the same name.
+	AllowedRegistries []string `json:"allowed_registries"`
+	// require a valid sigstore/GPG signature according to SignaturePolicyPath
+	RequireSignature bool `json:"require_signature"`
+	// containers-policy.json(5) file holding the signature requirements
+	SignaturePolicyPath string `json:"signature_policy_path"`
+	// only accept references that name a digest (repo@sha256:...)
+	RequireDigest bool `json:"require_digest"`
+	// repository name to the only digest allowed for it; a matching pin also
+	// satisfies RequireSignature so vetted images can run on offline nodes
+	PinnedDigests map[string]string `json:"pinned_digests"`
+}
+
+// ImageInfo is what is known about an image in local storage, if anything.
+type ImageInfo struct {
+	RepoTags    []string
+	RepoDigests []string
+}
+
+// Decision is the outcome of evaluating a policy for one image.
+type Decision struct {
+	Image      string   `json:"image"`
+	Repository string   `json:"repository"`
+	Registry   string   `json:"registry"`
+	Digest     string   `json:"digest,omitempty"`
+	Signed     bool     `json:"signed"`
+	Allowed    bool     `json:"allowed"`
+	Reasons    []string `json:"reasons,omitempty"`
+}
+
+// RejectedError is returned when an image does not satisfy the trust policy.
+type RejectedError struct {
+	Image   string
+	Reasons []string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("image %s rejected by trust policy: %s", e.Image, strings.Join(e.Reasons, "; "))
+}
+
+// Dependency injection variables for testing:
+var (
+	verifySignatureFunc = verifySignature
+)
+
+// Enabled reports whether the policy restricts anything at all.
+func (p Policy) Enabled() bool {
+	return len(p.AllowedRegistries) > 0 || p.RequireSignature || p.RequireDigest || len(p.PinnedDigests) > 0
+}
+
+// Evaluate checks image against the policy. local describes the image in
+// local storage and is used to resolve image IDs and digests; it may be nil.
+func (p Policy) Evaluate(ctx context.Context, imageName string, local *ImageInfo) Decision {
+	decision := Decision{Image: imageName}
+	if !p.Enabled() {
+		decision.Allowed = true
+		return decision
+	}
+
+	named, err := resolveReference(imageName, local)
+	if err != nil {
+		decision.Reasons = append(decision.Reasons, err.Error())
+		return decision
+	}
+	decision.Repository = named.Name()
+	decision.Registry = reference.Domain(named)
+	var digests []string
+	if local != nil {
+		// the image that runs is the local one, whatever name it was given
+		digests = localDigests(named.Name(), local.RepoDigests)
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		decision.Digest = digested.Digest().String()
+		if local != nil && !contains(digests, decision.Digest) {
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("local image was not pulled as %s", named.String()))
+		}
+	} else if len(digests) > 0 {
+		decision.Digest = digests[0]
+	}
+	if local != nil && len(digests) == 0 && (len(p.AllowedRegistries) > 0 || p.RequireSignature) {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("local image has no digest from %s, it was loaded, built or tagged on this node", named.Name()))
+	}
+
+	if !p.registryAllowed(named) {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("registry %s is not in the allowed registries", decision.Registry))
+	}
+	if _, ok := named.(reference.Digested); p.RequireDigest && !ok {
+		decision.Reasons = append(decision.Reasons, "image must be referenced by digest")
+	}
+	pinned, hasPin := p.PinnedDigests[named.Name()]
+	if hasPin && pinned != decision.Digest && !contains(digests, pinned) {
+		if decision.Digest == "" {
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("digest of %s is unknown, expected pinned digest %s", named.Name(), pinned))
+		} else {
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("digest %s does not match pinned digest %s", decision.Digest, pinned))
+		}
+	}
+	// local images without a digest were rejected above, nothing to verify
+	if p.RequireSignature && !hasPin && (local == nil || decision.Digest != "") {
+		if err := verifySignatureFunc(ctx, p.signaturePolicyPath(), verifiedReference(named, decision.Digest)); err != nil {
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("signature verification failed: %v", err))
+		} else {
+			decision.Signed = true
+		}
+	}
+
+	decision.Allowed = len(decision.Reasons) == 0
+	return decision
+}
+
+// Check evaluates the policy and turns a rejection into a *RejectedError.
+func (p Policy) Check(ctx context.Context, imageName string, local *ImageInfo) error {
+	decision := p.Evaluate(ctx, imageName, local)
+	if !decision.Allowed {
+		return &RejectedError{Image: imageName, Reasons: decision.Reasons}
+	}
+	return nil
+}
+
+func (p Policy) signaturePolicyPath() string {
+	if p.SignaturePolicyPath != "" {
+		return p.SignaturePolicyPath
+	}
+	return defaultSignaturePolicyPath
+}
+
+func (p Policy) registryAllowed(named reference.Named) bool {
+	if len(p.AllowedRegistries) == 0 {
+		return true
+	}
+	domain := reference.Domain(named)
+	for _, allowed := range p.AllowedRegistries {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if domain == allowed || named.Name() == allowed || strings.HasPrefix(named.Name(), allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveReference parses imageName, falling back to the local image's first
+// tag or digest when imageName is an image ID.
+func resolveReference(imageName string, local *ImageInfo) (reference.Named, error) {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err == nil && !isImageID(imageName) {
+		return reference.TagNameOnly(named), nil
+	}
+	if local != nil {
+		for _, name := range append(local.RepoDigests, local.RepoTags...) {
+			if named, err := reference.ParseNormalizedNamed(name); err == nil {
+				return reference.TagNameOnly(named), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot determine the repository of %s", imageName)
+}
+
+// isImageID matches full or short hex image IDs, which parse as repository names.
+func isImageID(s string) bool {
+	s = strings.TrimPrefix(s, "sha256:")
+	if len(s) < 12 || len(s) > 64 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifiedReference is the manifest whose signature is checked: the one the
+// local image was pulled as, not what the tag points at in the registry now.
+func verifiedReference(named reference.Named, localDigest string) reference.Named {
+	if _, ok := named.(reference.Digested); ok || localDigest == "" {
+		return named
+	}
+	if digested, err := reference.WithDigest(reference.TrimNamed(named), digest.Digest(localDigest)); err == nil {
+		return digested
+	}
+	return named
+}
+
+// localDigests returns the digests recorded for repo in the local RepoDigests.
+func localDigests(repo string, repoDigests []string) []string {
+	digests := []string{}
+	for _, rd := range repoDigests {
+		named, err := reference.ParseNormalizedNamed(rd)
+		if err != nil || named.Name() != repo {
+			continue
+		}
+		if digested, ok := named.(reference.Digested); ok {
+			digests = append(digests, digested.Digest().String())
+		}
+	}
+	return digests
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature checks the image in its registry against the signature
+// requirements in policyPath. named carries the digest of the local image
+// when there is one.
+func verifySignature(ctx context.Context, policyPath string, named reference.Named) error {
+	policy, err := signature.NewPolicyFromFile(policyPath)
+	if err != nil {
+		return fmt.Errorf("loading signature policy: %w", err)
+	}
+	policyContext, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return fmt.Errorf("creating policy context: %w", err)
+	}
+	defer policyContext.Destroy()
+
+	ref, err := docker.NewReference(named)
+	if err != nil {
+		return err
+	}
+	src, err := ref.NewImageSource(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("reading image from registry: %w", err)
+	}
+	defer src.Close()
+
+	allowed, err := policyContext.IsRunningImageAllowed(ctx, image.UnparsedInstance(src, nil))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("image is not signed as required")
+	}
+	return nil
+}
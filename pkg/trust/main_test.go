@@ -0,0 +1,115 @@
+package trust
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+)
+
+const testDigest = "sha256:0123456789012345678901234567890123456789012345678901234567890123"
+
+func TestEvaluate_EmptyPolicyAllowsAll(t *testing.T) {
+	decision := Policy{}.Evaluate(context.Background(), "anything", nil)
+	if !decision.Allowed {
+		t.Fatalf("expected empty policy to allow, got: %#v", decision)
+	}
+}
+
+func TestEvaluate_AllowedRegistries(t *testing.T) {
+	policy := Policy{AllowedRegistries: []string{"registry.lab.local", "quay.io/abra"}}
+	tests := map[string]bool{
+		"registry.lab.local/ebpf/base:latest": true,
+		"quay.io/abra/tools":                  true,
+		"quay.io/other/tools":                 false,
+		"ubuntu":                              false,
+	}
+	for image, want := range tests {
+		decision := policy.Evaluate(context.Background(), image, nil)
+		if decision.Allowed != want {
+			t.Errorf("%s: expected allowed=%v, got: %#v", image, want, decision)
+		}
+	}
+}
+
+func TestEvaluate_PinnedDigest(t *testing.T) {
+	policy := Policy{PinnedDigests: map[string]string{"registry.lab.local/ebpf": testDigest}}
+
+	local := &ImageInfo{RepoDigests: []string{"registry.lab.local/ebpf@" + testDigest}}
+	if d := policy.Evaluate(context.Background(), "registry.lab.local/ebpf:latest", local); !d.Allowed || d.Digest != testDigest {
+		t.Errorf("expected pinned local image to be allowed, got: %#v", d)
+	}
+	d := policy.Evaluate(context.Background(), "registry.lab.local/ebpf:latest", nil)
+	if d.Allowed || !strings.Contains(strings.Join(d.Reasons, ";"), "unknown") {
+		t.Errorf("expected image with unknown digest to be rejected, got: %#v", d)
+	}
+}
+
+func TestEvaluate_ImageIDResolvedFromLocalTags(t *testing.T) {
+	policy := Policy{AllowedRegistries: []string{"registry.lab.local"}}
+	local := &ImageInfo{
+		RepoTags:    []string{"registry.lab.local/ebpf:latest"},
+		RepoDigests: []string{"registry.lab.local/ebpf@" + testDigest},
+	}
+	d := policy.Evaluate(context.Background(), "0123456789ab", local)
+	if !d.Allowed || d.Registry != "registry.lab.local" {
+		t.Errorf("expected image ID to resolve to its local tag, got: %#v", d)
+	}
+}
+
+func TestCheck_RequireSignatureAndDigest(t *testing.T) {
+	orig := verifySignatureFunc
+	defer func() { verifySignatureFunc = orig }()
+	verifySignatureFunc = func(ctx context.Context, policyPath string, named reference.Named) error {
+		return errors.New("no signature")
+	}
+
+	policy := Policy{RequireSignature: true, RequireDigest: true}
+	err := policy.Check(context.Background(), "registry.lab.local/ebpf:latest", nil)
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected RejectedError, got: %v", err)
+	}
+	if len(rejected.Reasons) != 2 {
+		t.Errorf("expected digest and signature reasons, got: %v", rejected.Reasons)
+	}
+}
+
+func TestEvaluate_RetaggedLocalImage(t *testing.T) {
+	// pulled from elsewhere, then tagged under an allowed name
+	local := &ImageInfo{
+		RepoTags:    []string{"registry.lab.local/ebpf:latest"},
+		RepoDigests: []string{"docker.io/evil/ebpf@" + testDigest},
+	}
+	policy := Policy{AllowedRegistries: []string{"registry.lab.local"}}
+	d := policy.Evaluate(context.Background(), "registry.lab.local/ebpf:latest", local)
+	if d.Allowed || !strings.Contains(strings.Join(d.Reasons, ";"), "no digest") {
+		t.Errorf("expected retagged image to be rejected, got: %#v", d)
+	}
+}
+
+func TestEvaluate_VerifiesLocalDigest(t *testing.T) {
+	orig := verifySignatureFunc
+	defer func() { verifySignatureFunc = orig }()
+	var verified string
+	verifySignatureFunc = func(ctx context.Context, policyPath string, named reference.Named) error {
+		verified = named.String()
+		return nil
+	}
+
+	local := &ImageInfo{RepoDigests: []string{"registry.lab.local/ebpf@" + testDigest}}
+	d := Policy{RequireSignature: true}.Evaluate(context.Background(), "registry.lab.local/ebpf:latest", local)
+	if !d.Allowed || !d.Signed {
+		t.Fatalf("expected signed image to be allowed, got: %#v", d)
+	}
+	if verified != "registry.lab.local/ebpf@"+testDigest {
+		t.Errorf("expected the local digest to be verified, got: %s", verified)
+	}
+
+	d = Policy{RequireSignature: true}.Evaluate(context.Background(), "registry.lab.local/ebpf:latest", &ImageInfo{})
+	if d.Allowed {
+		t.Errorf("expected image without registry digest to be rejected, got: %#v", d)
+	}
+}